@@ -2,87 +2,210 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
+	"regproxy/crawler"
+	"regproxy/secrets"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ElevenLabsMode selects how much of the API a check exercises
+type ElevenLabsMode string
+
+const (
+	// ModeFull synthesizes the test payload on every check, spending quota
+	ModeFull ElevenLabsMode = "full"
+	// ModeLight calls a free read-only endpoint and only synthesizes on the
+	// full check schedule or sampling rate
+	ModeLight ElevenLabsMode = "light"
+)
+
+// errorBodyBytes caps how much of an error response is read
+const errorBodyBytes = 64 << 10
+
 // ElevenLabsTester tests proxies against ElevenLabs API
 type ElevenLabsTester struct {
+	name      string
 	apiKey    string
 	apiURL    string
 	payload   string
 	timeout   time.Duration
 	userAgent string
+
+	// Response validation
+	expectMP3    bool
+	maxBodyBytes int64
+
+	// Light mode
+	mode         ElevenLabsMode
+	lightURL     string
+	fullInterval time.Duration
+	sampleRate   float64
+
+	mu        sync.Mutex
+	lastFull  time.Time
+	fullCycle atomic.Bool
+
+	// Characters in the payload text and characters spent so far
+	payloadChars int64
+	usage        atomic.Int64
 }
 
-// NewElevenLabsTester creates a new ElevenLabs API tester
+// NewElevenLabsTester creates a new ElevenLabs API tester that runs a full
+// synthesis on every check
 func NewElevenLabsTester(apiKey, apiURL, payload string, timeout time.Duration) *ElevenLabsTester {
 	return &ElevenLabsTester{
-		apiKey:    apiKey,
-		apiURL:    apiURL,
-		payload:   payload,
-		timeout:   timeout,
-		userAgent: "RegProxy/1.0",
+		name:         "elevenlabs",
+		apiKey:       apiKey,
+		apiURL:       apiURL,
+		payload:      payload,
+		timeout:      timeout,
+		userAgent:    "RegProxy/1.0",
+		expectMP3:    requestsMP3(apiURL),
+		maxBodyBytes: 1 << 20,
+		mode:         ModeFull,
+		lightURL:     "https://api.elevenlabs.io/v1/models",
+		payloadChars: payloadCharacters(payload),
+	}
+}
+
+// payloadCharacters returns the number of characters ElevenLabs bills for
+// the payload, which is the length of its text field
+func payloadCharacters(payload string) int64 {
+	var body struct {
+		Text string `json:"text"`
 	}
+	if err := json.Unmarshal([]byte(payload), &body); err != nil {
+		return 0
+	}
+	return int64(len([]rune(body.Text)))
+}
+
+// SetMaxBodyBytes sets how much of a successful response is read
+func (e *ElevenLabsTester) SetMaxBodyBytes(maxBytes int64) {
+	e.maxBodyBytes = maxBytes
+}
+
+// SetMode sets whether checks synthesize speech or call the light endpoint
+func (e *ElevenLabsTester) SetMode(mode ElevenLabsMode) {
+	e.mode = mode
+}
+
+// SetLightURL sets the read-only endpoint used in light mode
+func (e *ElevenLabsTester) SetLightURL(lightURL string) {
+	e.lightURL = lightURL
+}
+
+// SetFullCheckSchedule makes light mode run a full synthesis for a whole
+// cycle every interval, and for a sampleRate fraction of the checks in the
+// other cycles. Zero disables either.
+func (e *ElevenLabsTester) SetFullCheckSchedule(interval time.Duration, sampleRate float64) {
+	e.fullInterval = interval
+	e.sampleRate = sampleRate
+}
+
+// BeginCycle decides whether the coming cycle is a scheduled full cycle,
+// implementing crawler.CycleChecker
+func (e *ElevenLabsTester) BeginCycle() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	full := e.fullInterval > 0 && time.Since(e.lastFull) >= e.fullInterval
+	if full {
+		e.lastFull = time.Now()
+	}
+	e.fullCycle.Store(full)
+}
+
+// TakeUsage returns the characters spent on synthesis since the last call,
+// implementing crawler.UsageReporter
+func (e *ElevenLabsTester) TakeUsage() int64 {
+	return e.usage.Swap(0)
+}
+
+// useFull reports whether the next check should synthesize speech
+func (e *ElevenLabsTester) useFull() bool {
+	if e.mode != ModeLight || e.fullCycle.Load() {
+		return true
+	}
+	return e.sampleRate > 0 && rand.Float64() < e.sampleRate
 }
 
 // TestResult represents the result of testing a proxy with ElevenLabs API
-type TestResult struct {
-	Proxy       string
-	IsWorking   bool
-	StatusCode  int
-	Latency     time.Duration
-	Error       error
-	ResponseLen int
+type TestResult = crawler.CheckResult
+
+// Name returns the name of the check
+func (e *ElevenLabsTester) Name() string {
+	return e.name
+}
+
+// SetName sets the name the check reports in results
+func (e *ElevenLabsTester) SetName(name string) {
+	e.name = name
+}
+
+// Check tests a single proxy, implementing crawler.Checker
+func (e *ElevenLabsTester) Check(ctx context.Context, proxyAddr string) crawler.CheckResult {
+	return e.TestProxy(ctx, proxyAddr)
 }
 
 // TestProxy tests a single proxy against ElevenLabs API
 func (e *ElevenLabsTester) TestProxy(ctx context.Context, proxyAddr string) TestResult {
 	result := TestResult{
 		Proxy:     proxyAddr,
+		Check:     e.Name(),
 		IsWorking: false,
 	}
 
 	startTime := time.Now()
 
-	// Create proxy URL
-	proxyURL, err := url.Parse("http://" + proxyAddr)
+	// Create HTTP client with proxy
+	client, err := crawler.NewProxyClient(ctx, proxyAddr, e.timeout)
 	if err != nil {
-		result.Error = fmt.Errorf("invalid proxy URL: %v", err)
+		result.Error = err
+		result.ErrorClass = crawler.ClassUnknown
 		return result
 	}
 
-	// Create HTTP client with proxy
-	transport := &http.Transport{
-		Proxy:             http.ProxyURL(proxyURL),
-		DisableKeepAlives: true,
-	}
-
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   e.timeout,
+	// Create request, synthesizing only when a full check is due
+	full := e.useFull()
+	var req *http.Request
+	if full {
+		req, err = http.NewRequestWithContext(ctx, "POST", e.apiURL, strings.NewReader(e.payload))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, "GET", e.lightURL, nil)
 	}
-
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", e.apiURL, strings.NewReader(e.payload))
 	if err != nil {
-		result.Error = fmt.Errorf("error creating request: %v", err)
+		result.Error = secrets.RedactError(fmt.Errorf("error creating request: %v", err))
+		result.ErrorClass = crawler.ClassUnknown
 		return result
 	}
 
 	// Set headers
 	req.Header.Set("xi-api-key", e.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	if full {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	req.Header.Set("User-Agent", e.userAgent)
 
 	// Make request
 	resp, err := client.Do(req)
 	if err != nil {
-		result.Error = err
+		// Transport errors quote the URL, which may carry a key
+		result.Error = secrets.RedactError(err)
+		result.ErrorClass = crawler.ClassifyError(err)
+		if ctx.Err() != nil {
+			result.ErrorClass = crawler.ClassCanceled
+		}
 		return result
 	}
 	defer resp.Body.Close()
@@ -90,95 +213,161 @@ func (e *ElevenLabsTester) TestProxy(ctx context.Context, proxyAddr string) Test
 	result.Latency = time.Since(startTime)
 	result.StatusCode = resp.StatusCode
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		result.Error = fmt.Errorf("error reading response: %v", err)
+	// Error bodies are small JSON documents, only keep their start
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyBytes))
+		result.ResponseLen = len(body)
+		result.ErrorClass = classifyElevenLabsStatus(resp.StatusCode, body)
+		result.Error = crawler.NewTestError(result.ErrorClass,
+			fmt.Errorf("HTTP %d: %s", resp.StatusCode, secrets.Redact(string(body[:min(200, len(body))]))))
 		return result
 	}
 
-	result.ResponseLen = len(body)
+	// A 2xx alone is not enough, some proxies answer with their own page
+	n, err := e.validateBody(resp, full)
+	result.ResponseLen = int(n)
+	if err != nil {
+		result.Error = err
+		result.ErrorClass = crawler.ClassifyError(err)
+		return result
+	}
 
-	// Check if request was successful
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		result.IsWorking = true
-	} else {
-		result.Error = fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body[:min(200, len(body))]))
+	result.IsWorking = true
+	if full {
+		e.usage.Add(e.payloadChars)
 	}
 
 	return result
 }
 
-// TestProxies tests multiple proxies concurrently
-func (e *ElevenLabsTester) TestProxies(ctx context.Context, proxies []string, maxWorkers int) []TestResult {
-	results := make([]TestResult, 0, len(proxies))
-	resultsChan := make(chan TestResult, len(proxies))
-	semaphore := make(chan struct{}, maxWorkers)
-
-	// Start workers
-	for _, proxy := range proxies {
-		go func(proxyAddr string) {
-			// Acquire semaphore
-			select {
-			case semaphore <- struct{}{}:
-			case <-ctx.Done():
-				return
-			}
-			defer func() { <-semaphore }()
-
-			result := e.TestProxy(ctx, proxyAddr)
-			resultsChan <- result
-		}(proxy)
-	}
-
-	// Collect results
-	for i := 0; i < len(proxies); i++ {
-		select {
-		case result := <-resultsChan:
-			results = append(results, result)
-		case <-ctx.Done():
-			return results
+// validateBody checks the Content-Type of a successful response and streams
+// at most maxBodyBytes of the body. Synthesized audio must start with an ID3
+// tag or an MP3 frame when MP3 output was requested.
+func (e *ElevenLabsTester) validateBody(resp *http.Response, full bool) (int64, error) {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	if !full {
+		if mediaType != "application/json" {
+			return 0, crawler.NewTestError(crawler.ClassBodyValidation,
+				fmt.Errorf("unexpected Content-Type %q", mediaType))
 		}
+		return drainBody(resp.Body, e.maxBodyBytes)
+	}
+
+	switch {
+	case e.expectMP3 && mediaType != "audio/mpeg",
+		!e.expectMP3 && !strings.HasPrefix(mediaType, "audio/"):
+		return 0, crawler.NewTestError(crawler.ClassBodyValidation,
+			fmt.Errorf("unexpected Content-Type %q", mediaType))
+	}
+
+	if !e.expectMP3 {
+		return drainBody(resp.Body, e.maxBodyBytes)
+	}
+
+	header := make([]byte, 3)
+	if n, err := io.ReadFull(resp.Body, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return int64(n), crawler.NewTestError(crawler.ClassBodyValidation,
+				fmt.Errorf("audio response too short (%d bytes)", n))
+		}
+		return int64(n), fmt.Errorf("error reading response: %w", err)
+	}
+
+	if !isMP3Start(header) {
+		return int64(len(header)), crawler.NewTestError(crawler.ClassBodyValidation,
+			fmt.Errorf("response is not MP3 audio (starts with % x)", header))
+	}
+
+	n, err := drainBody(resp.Body, e.maxBodyBytes-int64(len(header)))
+	return n + int64(len(header)), err
+}
+
+// drainBody reads and discards at most limit bytes of body
+func drainBody(body io.Reader, limit int64) (int64, error) {
+	n, err := io.Copy(io.Discard, io.LimitReader(body, limit))
+	if err != nil {
+		return n, fmt.Errorf("error reading response after %d bytes: %w", n, err)
 	}
+	return n, nil
+}
 
-	return results
+// isMP3Start reports whether b starts with an ID3v2 tag or an MPEG audio
+// frame sync (11 set bits)
+func isMP3Start(b []byte) bool {
+	if len(b) >= 3 && string(b[:3]) == "ID3" {
+		return true
+	}
+	return len(b) >= 2 && b[0] == 0xFF && b[1]&0xE0 == 0xE0
+}
+
+// requestsMP3 reports whether the synthesis URL asks for MP3 output, which
+// is the ElevenLabs default when no output_format is given
+func requestsMP3(apiURL string) bool {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return true
+	}
+	format := u.Query().Get("output_format")
+	return format == "" || strings.HasPrefix(format, "mp3")
+}
+
+// classifyElevenLabsStatus tells account-level rejections such as a wrong
+// key or exhausted quota apart from failures caused by the proxy. ElevenLabs
+// also answers 401 when it flags the caller's IP, which is the proxy's fault.
+func classifyElevenLabsStatus(statusCode int, body []byte) crawler.ErrorClass {
+	var errBody struct {
+		Detail struct {
+			Status string `json:"status"`
+		} `json:"detail"`
+	}
+	json.Unmarshal(body, &errBody)
+
+	switch {
+	case errBody.Detail.Status == "quota_exceeded":
+		return crawler.ClassTargetAuth
+	case errBody.Detail.Status == "detected_unusual_activity":
+		return crawler.ClassHTTPStatus
+	case statusCode == http.StatusUnauthorized:
+		return crawler.ClassTargetAuth
+	default:
+		return crawler.ClassifyStatus(statusCode)
+	}
+}
+
+// TestProxies tests multiple proxies concurrently using at most maxWorkers
+// goroutines
+func (e *ElevenLabsTester) TestProxies(ctx context.Context, proxies []string, maxWorkers int) ([]TestResult, error) {
+	return crawler.NewRunner(maxWorkers).Run(ctx, e, proxies)
 }
 
 // GetWorkingProxies returns only the working proxies from test results
 func GetWorkingProxies(results []TestResult) []string {
-	var working []string
-	for _, result := range results {
-		if result.IsWorking {
-			working = append(working, result.Proxy)
-		}
-	}
-	return working
+	return crawler.GetWorkingProxies(results)
 }
 
 // PrintResults prints test results in a formatted way
 func PrintResults(results []TestResult, verbose bool) {
-	working := 0
-	failed := 0
-
-	for _, result := range results {
+	infos := make([]crawler.ProxyInfo, len(results))
+	for i, result := range results {
+		infos[i] = crawler.InfoFromResult(result)
+		if !verbose {
+			continue
+		}
 		if result.IsWorking {
-			working++
-			if verbose {
-				fmt.Printf("✅ %s - %dms - HTTP %d - %d bytes\n", 
-					result.Proxy, result.Latency.Milliseconds(), result.StatusCode, result.ResponseLen)
-			}
+			fmt.Printf("✅ %s - %dms - HTTP %d - %d bytes\n",
+				result.Proxy, result.Latency.Milliseconds(), result.StatusCode, result.ResponseLen)
 		} else {
-			failed++
-			if verbose {
-				fmt.Printf("❌ %s - %v\n", result.Proxy, result.Error)
-			}
+			fmt.Printf("❌ %s - [%s] %v\n", result.Proxy, result.ErrorClass, result.Error)
 		}
 	}
 
-	fmt.Printf("\n📊 ElevenLabs API Test Results:\n")
-	fmt.Printf("   Working: %d\n", working)
-	fmt.Printf("   Failed: %d\n", failed)
-	fmt.Printf("   Success Rate: %.2f%%\n", float64(working)/float64(len(results))*100)
+	checkName := "ElevenLabs API"
+	if len(results) > 0 && results[0].Check != "" {
+		checkName = results[0].Check
+	}
+
+	crawler.ComputeStats(infos).WriteText(os.Stdout, checkName+" Test Results")
 }
 
 func min(a, b int) int {
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"regproxy/crawler"
+	"regproxy/secrets"
+	"strings"
+	"time"
+)
+
+// HTTPCheckSpec describes the request an HTTPCheck sends and what the
+// response must look like for the proxy to pass
+type HTTPCheckSpec struct {
+	Name         string
+	Method       string
+	URL          string
+	Headers      map[string]string
+	Body         string
+	MinStatus    int
+	MaxStatus    int
+	BodyContains []string
+	BodyRegex    string
+	MaxBodyBytes int64
+	Timeout      time.Duration
+}
+
+// HTTPCheck tests proxies with a configurable HTTP request
+type HTTPCheck struct {
+	spec      HTTPCheckSpec
+	bodyRegex *regexp.Regexp
+	userAgent string
+}
+
+// NewHTTPCheck creates a new HTTP check from spec
+func NewHTTPCheck(spec HTTPCheckSpec) (*HTTPCheck, error) {
+	if spec.URL == "" {
+		return nil, fmt.Errorf("check %q: url is required", spec.Name)
+	}
+	if spec.Method == "" {
+		spec.Method = "GET"
+	}
+	if spec.MinStatus == 0 && spec.MaxStatus == 0 {
+		spec.MinStatus, spec.MaxStatus = 200, 299
+	}
+	if spec.MaxBodyBytes <= 0 {
+		spec.MaxBodyBytes = 1 << 20
+	}
+
+	check := &HTTPCheck{
+		spec:      spec,
+		userAgent: "RegProxy/1.0",
+	}
+
+	if spec.BodyRegex != "" {
+		re, err := regexp.Compile(spec.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("check %q: invalid body_regex: %v", spec.Name, err)
+		}
+		check.bodyRegex = re
+	}
+
+	return check, nil
+}
+
+// Name returns the name of the check
+func (h *HTTPCheck) Name() string {
+	return h.spec.Name
+}
+
+// Check sends the configured request through a single proxy, implementing
+// crawler.Checker
+func (h *HTTPCheck) Check(ctx context.Context, proxyAddr string) crawler.CheckResult {
+	result := crawler.CheckResult{
+		Proxy: proxyAddr,
+		Check: h.Name(),
+	}
+
+	startTime := time.Now()
+
+	client, err := crawler.NewProxyClient(ctx, proxyAddr, h.spec.Timeout)
+	if err != nil {
+		result.Error = err
+		result.ErrorClass = crawler.ClassUnknown
+		return result
+	}
+
+	var body io.Reader
+	if h.spec.Body != "" {
+		body = strings.NewReader(h.spec.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, h.spec.Method, h.spec.URL, body)
+	if err != nil {
+		result.Error = secrets.RedactError(fmt.Errorf("error creating request: %v", err))
+		result.ErrorClass = crawler.ClassUnknown
+		return result
+	}
+
+	req.Header.Set("User-Agent", h.userAgent)
+	for key, value := range h.spec.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Transport errors quote the URL, which may carry a key
+		result.Error = secrets.RedactError(err)
+		result.ErrorClass = crawler.ClassifyError(err)
+		if ctx.Err() != nil {
+			result.ErrorClass = crawler.ClassCanceled
+		}
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.Latency = time.Since(startTime)
+	result.StatusCode = resp.StatusCode
+
+	// Only read as much of the body as the assertions may look at
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, h.spec.MaxBodyBytes))
+	if err != nil {
+		result.Error = fmt.Errorf("error reading response: %v", err)
+		result.ErrorClass = crawler.ClassifyError(err)
+		return result
+	}
+	result.ResponseLen = len(respBody)
+
+	if resp.StatusCode < h.spec.MinStatus || resp.StatusCode > h.spec.MaxStatus {
+		result.ErrorClass = crawler.ClassifyStatus(resp.StatusCode)
+		result.Error = crawler.NewTestError(result.ErrorClass,
+			fmt.Errorf("HTTP %d: %s", resp.StatusCode, secrets.Redact(string(respBody[:min(200, len(respBody))]))))
+		return result
+	}
+
+	if err := h.validateBody(respBody); err != nil {
+		result.ErrorClass = crawler.ClassBodyValidation
+		result.Error = crawler.NewTestError(result.ErrorClass, err)
+		return result
+	}
+
+	result.IsWorking = true
+	return result
+}
+
+// validateBody checks the response body against the configured assertions
+func (h *HTTPCheck) validateBody(body []byte) error {
+	for _, want := range h.spec.BodyContains {
+		if !strings.Contains(string(body), want) {
+			return fmt.Errorf("response body does not contain %q", want)
+		}
+	}
+
+	if h.bodyRegex != nil && !h.bodyRegex.Match(body) {
+		return fmt.Errorf("response body does not match %q", h.spec.BodyRegex)
+	}
+
+	return nil
+}
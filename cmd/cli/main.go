@@ -1,23 +1,32 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"regproxy/api"
 	"regproxy/config"
 	"regproxy/crawler"
+	"regproxy/daemon"
+	"regproxy/secrets"
+	"strings"
 	"time"
 )
 
 func main() {
 	var (
 		configFile = flag.String("config", "config.yaml", "Path to configuration file")
-		action     = flag.String("action", "test", "Action to perform: test, crawl, validate")
-		proxyFile  = flag.String("file", "working_proxies.txt", "Proxy file to use")
-		count      = flag.Int("count", 10, "Number of proxies to test")
-		help       = flag.Bool("help", false, "Show help message")
+		action      = flag.String("action", "test", "Action to perform: test, crawl, validate, secret-keygen, secret-set, secret-list")
+		proxyFile   = flag.String("file", "working_proxies.txt", "Proxy file to use")
+		count       = flag.Int("count", 10, "Number of proxies to test")
+		proxyType   = flag.String("type", "http", "Protocol of the proxies in the file: http, https, socks4 or socks5")
+		secretsFile = flag.String("secrets", "secrets.json", "Encrypted secrets file for secret-set and secret-list")
+		keyFile     = flag.String("key-file", "", "Secrets key file (default: $"+secrets.KeyEnv+")")
+		secretName  = flag.String("name", "", "Secret name for secret-set")
+		help        = flag.Bool("help", false, "Show help message")
 	)
 	flag.Parse()
 
@@ -26,6 +35,20 @@ func main() {
 		return
 	}
 
+	// Secret actions work without a loadable config, since the config may
+	// reference the secret being added
+	switch *action {
+	case "secret-keygen":
+		generateSecretsKey()
+		return
+	case "secret-set":
+		setSecret(*secretsFile, *keyFile, *secretName)
+		return
+	case "secret-list":
+		listSecrets(*secretsFile, *keyFile)
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
@@ -34,7 +57,7 @@ func main() {
 
 	switch *action {
 	case "test":
-		testProxies(cfg, *proxyFile, *count)
+		testProxies(cfg, *proxyFile, *count, crawler.ProxyType(strings.ToLower(*proxyType)))
 	case "crawl":
 		crawlProxies(cfg)
 	case "validate":
@@ -45,12 +68,18 @@ func main() {
 	}
 }
 
-func testProxies(cfg *config.Config, proxyFile string, count int) {
-	fmt.Printf("🔍 Testing proxies from %s...\n", proxyFile)
+func testProxies(cfg *config.Config, proxyFile string, count int, proxyType crawler.ProxyType) {
+	switch proxyType {
+	case crawler.HTTP, crawler.HTTPS, crawler.SOCKS4, crawler.SOCKS5:
+	default:
+		log.Fatalf("Unknown proxy type %q, use http, https, socks4 or socks5", proxyType)
+	}
+
+	fmt.Printf("🔍 Testing %s proxies from %s...\n", proxyType, proxyFile)
 
 	// Load proxies
-	crawler := crawler.NewCrawler()
-	proxies, err := crawler.LoadFromFile(proxyFile)
+	proxyCrawler := crawler.NewCrawler()
+	proxies, err := proxyCrawler.LoadFromFile(proxyFile)
 	if err != nil {
 		log.Fatalf("Error loading proxies: %v", err)
 	}
@@ -66,21 +95,29 @@ func testProxies(cfg *config.Config, proxyFile string, count int) {
 	}
 	testProxies := proxies[:count]
 
-	fmt.Printf("Testing %d proxies against ElevenLabs API...\n", len(testProxies))
-
 	// Create tester
-	tester := api.NewElevenLabsTester(
-		cfg.API.ElevenLabs.Key,
-		cfg.API.ElevenLabs.URL,
-		cfg.API.ElevenLabs.TestPayload,
-		cfg.GetTimeout(),
-	)
+	tester, err := daemon.NewChecker(cfg)
+	if err != nil {
+		log.Fatalf("Error creating check: %v", err)
+	}
+
+	fmt.Printf("Testing %d proxies with %s check...\n", len(testProxies), tester.Name())
 
-	// Test proxies
+	// Test proxies with the protocol they were listed as
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
+	types := make(map[string]crawler.ProxyType, len(testProxies))
+	for _, proxy := range testProxies {
+		types[proxy] = proxyType
+	}
+	ctx = crawler.WithProxyTypes(ctx, types)
 
-	results := tester.TestProxies(ctx, testProxies, cfg.Daemon.Threads)
+	runner := crawler.NewRunner(cfg.Daemon.Threads)
+	runner.SetBreakerThreshold(cfg.Daemon.TargetErrorLimit)
+	results, err := runner.Run(ctx, tester, testProxies)
+	if err != nil {
+		log.Fatalf("Aborted: %v", err)
+	}
 
 	// Print results
 	api.PrintResults(results, true)
@@ -88,7 +125,7 @@ func testProxies(cfg *config.Config, proxyFile string, count int) {
 	// Save working proxies
 	workingProxies := api.GetWorkingProxies(results)
 	if len(workingProxies) > 0 {
-		if err := crawler.SaveToFile(workingProxies, "tested_working_proxies.txt"); err != nil {
+		if err := proxyCrawler.SaveToFile(workingProxies, "tested_working_proxies.txt"); err != nil {
 			log.Printf("Error saving working proxies: %v", err)
 		} else {
 			fmt.Printf("✅ Working proxies saved to tested_working_proxies.txt\n")
@@ -133,8 +170,7 @@ func crawlProxies(cfg *config.Config) {
 func validateConfig(cfg *config.Config) {
 	fmt.Println("🔍 Validating configuration...")
 
-	fmt.Printf("✅ ElevenLabs API Key: %s\n", maskAPIKey(cfg.API.ElevenLabs.Key))
-	fmt.Printf("✅ API URL: %s\n", cfg.API.ElevenLabs.URL)
+	fmt.Printf("✅ Check: %s\n", cfg.Daemon.Check)
 	fmt.Printf("✅ Test interval: %v\n", cfg.GetInterval())
 	fmt.Printf("✅ Threads: %d\n", cfg.Daemon.Threads)
 	fmt.Printf("✅ Timeout: %v\n", cfg.GetTimeout())
@@ -151,16 +187,33 @@ func validateConfig(cfg *config.Config) {
 		fmt.Printf("   Timeout: %v\n", cfg.GetMongoTimeout())
 	}
 
-	// Test API connection (basic validation)
-	fmt.Println("\n🔍 Testing ElevenLabs API configuration...")
-	
-	if cfg.API.ElevenLabs.Key == "" {
-		fmt.Println("❌ ElevenLabs API key is not set!")
-		return
+	// Checks used by the daemon
+	fmt.Println("\n🔍 Checks:")
+	for _, name := range cfg.UsedChecks() {
+		check, ok := cfg.GetCheck(name)
+		if !ok {
+			fmt.Printf("❌ Unknown check: %s\n", name)
+			return
+		}
+
+		switch check.Preset {
+		case config.PresetElevenLabs:
+			key, err := cfg.ElevenLabsKey()
+			if err != nil {
+				fmt.Printf("❌ %s: %v\n", name, err)
+				return
+			}
+			fmt.Printf("   %s: ElevenLabs preset, key %s, URL %s\n",
+				name, secrets.Mask(key), cfg.API.ElevenLabs.URL)
+		case config.PresetHTTPBin:
+			fmt.Printf("   %s: httpbin preset\n", name)
+		default:
+			fmt.Printf("   %s: %s %s\n", name, check.Method, check.URL)
+		}
 	}
-	
-	if cfg.API.ElevenLabs.URL == "" {
-		fmt.Println("❌ ElevenLabs API URL is not set!")
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Printf("❌ %v\n", err)
 		return
 	}
 
@@ -168,11 +221,65 @@ func validateConfig(cfg *config.Config) {
 	fmt.Println("\nNote: Run the daemon to test actual API connectivity with proxies.")
 }
 
-func maskAPIKey(key string) string {
-	if len(key) <= 8 {
-		return "***"
+func generateSecretsKey() {
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		log.Fatalf("Error generating key: %v", err)
+	}
+
+	fmt.Println(key)
+	fmt.Fprintf(os.Stderr, "Store this key in a file readable only by the daemon and set secrets.key_file, or export %s\n", secrets.KeyEnv)
+}
+
+func openSecrets(secretsFile, keyFile string) *secrets.Store {
+	key, err := secrets.LoadKey(keyFile)
+	if err != nil {
+		log.Fatalf("Error loading secrets key: %v", err)
+	}
+
+	store, err := secrets.OpenStore(secretsFile, key)
+	if err != nil {
+		log.Fatalf("Error opening secrets file: %v", err)
+	}
+	return store
+}
+
+func setSecret(secretsFile, keyFile, name string) {
+	if name == "" {
+		log.Fatalf("Use -name to name the secret")
+	}
+
+	store := openSecrets(secretsFile, keyFile)
+
+	// Read the value from stdin so it never shows up in the shell history
+	fmt.Fprintf(os.Stderr, "Value for %s: ", name)
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		log.Fatalf("Error reading secret value: %v", err)
+	}
+	value = strings.TrimRight(value, "\r\n")
+
+	if err := store.Set(name, value); err != nil {
+		log.Fatalf("Error encrypting secret: %v", err)
+	}
+	if err := store.Save(); err != nil {
+		log.Fatalf("Error saving secrets file: %v", err)
+	}
+
+	fmt.Printf("✅ Saved %s to %s, reference it as ${secret:%s}\n", name, secretsFile, name)
+}
+
+func listSecrets(secretsFile, keyFile string) {
+	store := openSecrets(secretsFile, keyFile)
+
+	for _, name := range store.Names() {
+		value, err := store.Get(name)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("   %s: %s\n", name, secrets.Mask(value))
 	}
-	return key[:4] + "..." + key[len(key)-4:]
 }
 
 func showHelp() {
@@ -183,9 +290,12 @@ func showHelp() {
 	fmt.Println("  regproxy-cli [flags]")
 	fmt.Println()
 	fmt.Println("Actions:")
-	fmt.Println("  test     - Test proxies against ElevenLabs API")
+	fmt.Println("  test     - Test proxies with the configured check (daemon.check)")
 	fmt.Println("  crawl    - Crawl new proxies from sources")
 	fmt.Println("  validate - Validate configuration")
+	fmt.Println("  secret-keygen - Generate a key for the encrypted secrets file")
+	fmt.Println("  secret-set    - Encrypt a secret read from stdin into the secrets file")
+	fmt.Println("  secret-list   - List the secrets in the secrets file, masked")
 	fmt.Println()
 	fmt.Println("Flags:")
 	flag.PrintDefaults()
@@ -194,9 +304,16 @@ func showHelp() {
 	fmt.Println("  # Test 20 proxies from working_proxies.txt")
 	fmt.Println("  regproxy-cli -action test -count 20")
 	fmt.Println()
+	fmt.Println("  # Test SOCKS5 proxies from a list")
+	fmt.Println("  regproxy-cli -action test -file socks5.txt -type socks5")
+	fmt.Println()
 	fmt.Println("  # Crawl new proxies")
 	fmt.Println("  regproxy-cli -action crawl")
 	fmt.Println()
 	fmt.Println("  # Validate configuration")
 	fmt.Println("  regproxy-cli -action validate")
+	fmt.Println()
+	fmt.Println("  # Store the ElevenLabs key encrypted")
+	fmt.Println("  regproxy-cli -action secret-keygen > secrets.key")
+	fmt.Println("  regproxy-cli -action secret-set -key-file secrets.key -name elevenlabs")
 }
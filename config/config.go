@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regproxy/secrets"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,9 +15,13 @@ import (
 type Config struct {
 	API struct {
 		ElevenLabs struct {
-			Key         string `yaml:"key"`
-			URL         string `yaml:"url"`
-			TestPayload string `yaml:"test_payload"`
+			Key                 string  `yaml:"key"`
+			URL                 string  `yaml:"url"`
+			TestPayload         string  `yaml:"test_payload"`
+			Mode                string  `yaml:"mode"`
+			LightURL            string  `yaml:"light_url"`
+			FullCheckInterval   int     `yaml:"full_check_interval"`
+			FullCheckSampleRate float64 `yaml:"full_check_sample_rate"`
 		} `yaml:"elevenlabs"`
 	} `yaml:"api"`
 
@@ -27,10 +34,15 @@ type Config struct {
 	} `yaml:"mongodb"`
 
 	Daemon struct {
-		Interval  int    `yaml:"interval"`
-		Threads   int    `yaml:"threads"`
-		Timeout   int    `yaml:"timeout"`
-		LogLevel  string `yaml:"log_level"`
+		Interval            int    `yaml:"interval"`
+		Threads             int    `yaml:"threads"`
+		Timeout             int    `yaml:"timeout"`
+		LogLevel            string `yaml:"log_level"`
+		Check               string `yaml:"check"`
+		AdaptiveConcurrency bool   `yaml:"adaptive_concurrency"`
+		MinThreads          int    `yaml:"min_threads"`
+		MaxThreads          int    `yaml:"max_threads"`
+		TargetErrorLimit    int    `yaml:"target_error_limit"`
 	} `yaml:"daemon"`
 
 	Proxy struct {
@@ -40,13 +52,155 @@ type Config struct {
 		KeepWorkingProxies     int `yaml:"keep_working_proxies"`
 	} `yaml:"proxy"`
 
+	Prefilter struct {
+		Enabled bool   `yaml:"enabled"`
+		Timeout int    `yaml:"timeout"`
+		Workers int    `yaml:"workers"`
+		Target  string `yaml:"target"`
+	} `yaml:"prefilter"`
+
+	Throughput struct {
+		Enabled           bool   `yaml:"enabled"`
+		URL               string `yaml:"url"`
+		MaxBytes          int64  `yaml:"max_bytes"`
+		Timeout           int    `yaml:"timeout"`
+		MinBytesPerSecond int64  `yaml:"min_bytes_per_second"`
+	} `yaml:"throughput"`
+
+	ExitIP struct {
+		Enabled      bool   `yaml:"enabled"`
+		JudgeURL     string `yaml:"judge_url"`
+		Timeout      int    `yaml:"timeout"`
+		MaxPerExitIP int    `yaml:"max_per_exit_ip"`
+	} `yaml:"exit_ip"`
+
+	GeoIP struct {
+		Enabled   bool   `yaml:"enabled"`
+		Path      string `yaml:"path"`
+		CountryDB string `yaml:"country_db"`
+		CityDB    string `yaml:"city_db"`
+		ASNDB     string `yaml:"asn_db"`
+	} `yaml:"geoip"`
+
+	Stability struct {
+		Enabled         bool    `yaml:"enabled"`
+		Samples         int     `yaml:"samples"`
+		Window          int     `yaml:"window"`
+		MinSuccessRatio float64 `yaml:"min_success_ratio"`
+		MaxP95LatencyMs int     `yaml:"max_p95_latency_ms"`
+		MaxJitterMs     int     `yaml:"max_jitter_ms"`
+	} `yaml:"stability"`
+
+	Scoring struct {
+		LatencyWeight    float64 `yaml:"latency_weight"`
+		SuccessWeight    float64 `yaml:"success_weight"`
+		UptimeWeight     float64 `yaml:"uptime_weight"`
+		ErrorWeight      float64 `yaml:"error_weight"`
+		ThroughputWeight float64 `yaml:"throughput_weight"`
+		LatencyAlpha     float64 `yaml:"latency_alpha"`
+		LatencyRefMs     int     `yaml:"latency_ref_ms"`
+		ThroughputRef    int64   `yaml:"throughput_ref"`
+		SuccessHalfLife  int     `yaml:"success_half_life"`
+		ErrorHalfLife    int     `yaml:"error_half_life"`
+		UptimeHorizon    int     `yaml:"uptime_horizon"`
+	} `yaml:"scoring"`
+
+	Lease struct {
+		TTL          int `yaml:"ttl"`
+		FailureLimit int `yaml:"failure_limit"`
+	} `yaml:"lease"`
+
+	Lifecycle struct {
+		SuspectInterval    int     `yaml:"suspect_interval"`
+		QuarantineInterval int     `yaml:"quarantine_interval"`
+		DeadInterval       int     `yaml:"dead_interval"`
+		BackoffFactor      float64 `yaml:"backoff_factor"`
+		MaxInterval        int     `yaml:"max_interval"`
+		SuspectFailures    int     `yaml:"suspect_failures"`
+		QuarantineFailures int     `yaml:"quarantine_failures"`
+	} `yaml:"lifecycle"`
+
+	Diversity struct {
+		MaxPerSubnet    int                `yaml:"max_per_subnet"`
+		MaxPerASN       int                `yaml:"max_per_asn"`
+		MaxCountryShare float64            `yaml:"max_country_share"`
+		MinTypeShare    map[string]float64 `yaml:"min_type_share"`
+	} `yaml:"diversity"`
+
+	Server struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+		Token   string `yaml:"token"`
+	} `yaml:"server"`
+
+	Checks []CheckConfig `yaml:"checks"`
+
+	Profiles []ProfileConfig `yaml:"profiles"`
+
+	Targets []string `yaml:"targets"`
+
+	Secrets struct {
+		File    string `yaml:"file"`
+		KeyFile string `yaml:"key_file"`
+	} `yaml:"secrets"`
+
 	Files struct {
 		WorkingProxies string `yaml:"working_proxies"`
 		AllProxies     string `yaml:"all_proxies"`
 		LogFile        string `yaml:"log_file"`
+		// Snapshot is where the full proxy state is written every cycle and
+		// restored from on start, empty to disable
+		Snapshot string `yaml:"snapshot"`
 	} `yaml:"files"`
 }
 
+// CheckConfig describes a named proxy check. A check either uses a preset
+// ("elevenlabs" or "httpbin") or sends the generic HTTP request described
+// by the remaining fields.
+type CheckConfig struct {
+	Name         string            `yaml:"name"`
+	Preset       string            `yaml:"preset"`
+	Method       string            `yaml:"method"`
+	URL          string            `yaml:"url"`
+	Headers      map[string]string `yaml:"headers"`
+	Body         string            `yaml:"body"`
+	ExpectStatus struct {
+		Min int `yaml:"min"`
+		Max int `yaml:"max"`
+	} `yaml:"expect_status"`
+	BodyContains []string `yaml:"body_contains"`
+	BodyRegex    string   `yaml:"body_regex"`
+	MaxBodyBytes int64    `yaml:"max_body_bytes"`
+	Timeout      int      `yaml:"timeout"`
+}
+
+// ProfileConfig describes a named pool of proxies that pass every check in
+// Checks. Each profile keeps its own working set.
+type ProfileConfig struct {
+	Name               string   `yaml:"name"`
+	Checks             []string `yaml:"checks"`
+	KeepWorkingProxies int      `yaml:"keep_working_proxies"`
+	WorkingProxies     string   `yaml:"working_proxies"`
+}
+
+// DefaultProfile is the name of the profile used when none are configured
+const DefaultProfile = "default"
+
+// Check presets
+const (
+	PresetElevenLabs = "elevenlabs"
+	PresetHTTPBin    = "httpbin"
+)
+
+// ElevenLabs check modes
+const (
+	// ElevenLabsModeFull synthesizes the test payload on every check
+	ElevenLabsModeFull = "full"
+	// ElevenLabsModeLight calls a free read-only endpoint and only runs a
+	// full synthesis on the configured schedule or sampling rate
+	ElevenLabsModeLight = "light"
+)
+
 // LoadConfig loads configuration from a YAML file
 func LoadConfig(configPath string) (*Config, error) {
 	config := &Config{}
@@ -56,15 +210,66 @@ func LoadConfig(configPath string) (*Config, error) {
 	config.Daemon.Threads = 20
 	config.Daemon.Timeout = 10
 	config.Daemon.LogLevel = "info"
+	config.Daemon.Check = "elevenlabs"
+	config.Daemon.AdaptiveConcurrency = false
+	config.Daemon.MinThreads = 5
+	config.Daemon.MaxThreads = 200
+	config.Daemon.TargetErrorLimit = 3
 	config.Proxy.SourcesRefreshInterval = 3600
 	config.Proxy.MaxCrawlWorkers = 15
 	config.Proxy.TestSampleSize = 100
 	config.Proxy.KeepWorkingProxies = 50
+	config.Prefilter.Enabled = false
+	config.Prefilter.Timeout = 3
+	config.Prefilter.Workers = 500
+	config.Prefilter.Target = "api.elevenlabs.io:443"
+	config.Throughput.Enabled = false
+	config.Throughput.URL = ""
+	config.Throughput.MaxBytes = 1048576
+	config.Throughput.Timeout = 30
+	config.Throughput.MinBytesPerSecond = 0
+	config.ExitIP.Enabled = false
+	config.ExitIP.JudgeURL = "http://httpbin.org/ip"
+	config.ExitIP.Timeout = 10
+	config.ExitIP.MaxPerExitIP = 1
+	config.GeoIP.Enabled = false
+	config.GeoIP.Path = "geoip"
+	config.Stability.Enabled = false
+	config.Stability.Samples = 5
+	config.Stability.Window = 10
+	config.Stability.MinSuccessRatio = 0.8
+	config.Scoring.LatencyWeight = 0.4
+	config.Scoring.SuccessWeight = 0.3
+	config.Scoring.UptimeWeight = 0.1
+	config.Scoring.ErrorWeight = 0.2
+	config.Scoring.LatencyAlpha = 0.3
+	config.Scoring.LatencyRefMs = 1000
+	config.Scoring.ThroughputWeight = 0
+	config.Scoring.ThroughputRef = 1048576
+	config.Scoring.SuccessHalfLife = 86400
+	config.Scoring.ErrorHalfLife = 3600
+	config.Scoring.UptimeHorizon = 86400
+	config.Lease.TTL = 300
+	config.Lease.FailureLimit = 3
+	config.Lifecycle.SuspectInterval = 60
+	config.Lifecycle.QuarantineInterval = 900
+	config.Lifecycle.DeadInterval = 86400
+	config.Lifecycle.BackoffFactor = 2
+	config.Lifecycle.MaxInterval = 259200
+	config.Lifecycle.SuspectFailures = 2
+	config.Lifecycle.QuarantineFailures = 4
+	config.Server.Enabled = false
+	config.Server.Listen = "127.0.0.1:8080"
 	config.Files.WorkingProxies = "working_proxies.txt"
 	config.Files.AllProxies = "proxies.txt"
 	config.Files.LogFile = "daemon.log"
+	config.Files.Snapshot = "proxy_snapshot.json"
 	config.API.ElevenLabs.URL = "https://api.elevenlabs.io/v1/text-to-speech/JBFqnCBsd6RMkjVDRZzb?output_format=mp3_44100_128"
 	config.API.ElevenLabs.TestPayload = `{"text": "The first move is what sets everything in motion.", "model_id": "eleven_multilingual_v2"}`
+	config.API.ElevenLabs.Mode = ElevenLabsModeFull
+	config.API.ElevenLabs.LightURL = "https://api.elevenlabs.io/v1/models"
+	config.API.ElevenLabs.FullCheckInterval = 0
+	config.API.ElevenLabs.FullCheckSampleRate = 0
 	config.MongoDB.Enabled = false
 	config.MongoDB.DSN = "mongodb://localhost:27017"
 	config.MongoDB.Database = "regproxy"
@@ -87,14 +292,335 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("error parsing config file: %v", err)
 	}
 
-	// Validate required fields
-	if config.API.ElevenLabs.Key == "" || config.API.ElevenLabs.Key == "your-elevenlabs-api-key-here" {
-		return nil, fmt.Errorf("please set your ElevenLabs API key in the config file")
+	// Open the encrypted secrets file so ${secret:NAME} references resolve
+	if config.Secrets.File != "" {
+		key, err := secrets.LoadKey(config.Secrets.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		store, err := secrets.OpenStore(config.Secrets.File, key)
+		if err != nil {
+			return nil, err
+		}
+		secrets.UseStore(store)
+	}
+
+	for i := range config.Checks {
+		if config.Checks[i].Preset == "" && config.Checks[i].Method == "" {
+			config.Checks[i].Method = "GET"
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
 
+// Validate checks that every check the daemon uses is fully configured
+func (c *Config) Validate() error {
+	if c.Daemon.Threads < 1 {
+		return fmt.Errorf("daemon.threads must be at least 1")
+	}
+	if c.Daemon.MinThreads < 1 || c.Daemon.MinThreads > c.Daemon.MaxThreads {
+		return fmt.Errorf("daemon.min_threads must be at least 1 and at most daemon.max_threads")
+	}
+
+	names := make(map[string]bool)
+	for _, check := range c.Checks {
+		if check.Name == "" {
+			return fmt.Errorf("every check needs a name")
+		}
+		if names[check.Name] {
+			return fmt.Errorf("duplicate check name %q", check.Name)
+		}
+		// Check names are used as keys in the stored reachability matrix
+		if strings.ContainsAny(check.Name, ".$") {
+			return fmt.Errorf("check name %q must not contain '.' or '$'", check.Name)
+		}
+		names[check.Name] = true
+	}
+
+	profileNames := make(map[string]bool)
+	for _, profile := range c.Profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("every profile needs a name")
+		}
+		if profileNames[profile.Name] {
+			return fmt.Errorf("duplicate profile name %q", profile.Name)
+		}
+		profileNames[profile.Name] = true
+		if len(profile.Checks) == 0 {
+			return fmt.Errorf("profile %q: at least one check is required", profile.Name)
+		}
+	}
+
+	if c.Throughput.Enabled && c.Throughput.URL == "" {
+		return fmt.Errorf("throughput.url is required when throughput is enabled")
+	}
+
+	if c.Stability.Enabled {
+		if c.Stability.Samples < 1 {
+			return fmt.Errorf("stability.samples must be at least 1")
+		}
+		if rate := c.Stability.MinSuccessRatio; rate < 0 || rate > 1 {
+			return fmt.Errorf("stability.min_success_ratio must be between 0 and 1")
+		}
+	}
+
+	weights := []float64{c.Scoring.LatencyWeight, c.Scoring.SuccessWeight, c.Scoring.UptimeWeight,
+		c.Scoring.ErrorWeight, c.Scoring.ThroughputWeight}
+	totalWeight := 0.0
+	for _, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("scoring weights must not be negative")
+		}
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		return fmt.Errorf("at least one scoring weight must be positive")
+	}
+	if alpha := c.Scoring.LatencyAlpha; alpha <= 0 || alpha > 1 {
+		return fmt.Errorf("scoring.latency_alpha must be above 0 and at most 1")
+	}
+
+	if c.Lifecycle.SuspectInterval <= 0 || c.Lifecycle.QuarantineInterval <= 0 || c.Lifecycle.DeadInterval <= 0 {
+		return fmt.Errorf("lifecycle intervals must be positive")
+	}
+	if c.Lifecycle.BackoffFactor < 1 {
+		return fmt.Errorf("lifecycle.backoff_factor must be at least 1")
+	}
+	if c.Lifecycle.SuspectFailures < 1 || c.Lifecycle.QuarantineFailures < 1 {
+		return fmt.Errorf("lifecycle failure limits must be at least 1")
+	}
+
+	if share := c.Diversity.MaxCountryShare; share < 0 || share > 1 {
+		return fmt.Errorf("diversity.max_country_share must be between 0 and 1")
+	}
+	totalShare := 0.0
+	for proxyType, share := range c.Diversity.MinTypeShare {
+		switch proxyType {
+		case "http", "https", "socks4", "socks5":
+		default:
+			return fmt.Errorf("diversity.min_type_share: unknown proxy type %q", proxyType)
+		}
+		if share < 0 || share > 1 {
+			return fmt.Errorf("diversity.min_type_share.%s must be between 0 and 1", proxyType)
+		}
+		totalShare += share
+	}
+	if totalShare > 1 {
+		return fmt.Errorf("diversity.min_type_share adds up to more than 1")
+	}
+
+	if c.Server.Enabled {
+		if c.Server.Listen == "" {
+			return fmt.Errorf("server.listen is required when the server is enabled")
+		}
+		if _, err := c.ServerToken(); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range c.UsedChecks() {
+		check, ok := c.GetCheck(name)
+		if !ok {
+			return fmt.Errorf("unknown check %q", name)
+		}
+
+		switch check.Preset {
+		case PresetElevenLabs:
+			// The key is only required when the ElevenLabs preset is used
+			if _, err := c.ElevenLabsKey(); err != nil {
+				return err
+			}
+			switch c.API.ElevenLabs.Mode {
+			case ElevenLabsModeFull, ElevenLabsModeLight:
+			default:
+				return fmt.Errorf("api.elevenlabs.mode must be %q or %q", ElevenLabsModeFull, ElevenLabsModeLight)
+			}
+			if rate := c.API.ElevenLabs.FullCheckSampleRate; rate < 0 || rate > 1 {
+				return fmt.Errorf("api.elevenlabs.full_check_sample_rate must be between 0 and 1")
+			}
+		case PresetHTTPBin:
+		case "":
+			if check.URL == "" {
+				return fmt.Errorf("check %q: url is required", name)
+			}
+			if _, err := check.ResolveHeaders(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("check %q: unknown preset %q", name, check.Preset)
+		}
+	}
+
+	return nil
+}
+
+// UsedChecks returns the names of the checks the daemon runs: the profile
+// checks followed by the extra reachability targets
+func (c *Config) UsedChecks() []string {
+	return append(c.ProfileChecks(), c.TargetChecks()...)
+}
+
+// ProfileChecks returns the names of the checks that decide which profiles
+// a proxy passes, in the order they first appear in the profiles
+func (c *Config) ProfileChecks() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, profile := range c.GetProfiles() {
+		for _, name := range profile.Checks {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// TargetChecks returns the reachability targets that are not already
+// profile checks. They only run on proxies that passed a profile and do
+// not affect which proxies are kept.
+func (c *Config) TargetChecks() []string {
+	seen := make(map[string]bool)
+	for _, name := range c.ProfileChecks() {
+		seen[name] = true
+	}
+
+	var names []string
+	for _, name := range c.Targets {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GetProfiles returns the configured profiles with defaults filled in. When
+// no profiles are configured a single default profile runs daemon.check
+// and keeps proxy.keep_working_proxies proxies in files.working_proxies.
+func (c *Config) GetProfiles() []ProfileConfig {
+	if len(c.Profiles) == 0 {
+		return []ProfileConfig{{
+			Name:               DefaultProfile,
+			Checks:             []string{c.Daemon.Check},
+			KeepWorkingProxies: c.Proxy.KeepWorkingProxies,
+			WorkingProxies:     c.Files.WorkingProxies,
+		}}
+	}
+
+	profiles := make([]ProfileConfig, len(c.Profiles))
+	for i, profile := range c.Profiles {
+		if profile.KeepWorkingProxies <= 0 {
+			profile.KeepWorkingProxies = c.Proxy.KeepWorkingProxies
+		}
+		if profile.WorkingProxies == "" {
+			// working_proxies.txt becomes working_proxies.<name>.txt
+			ext := filepath.Ext(c.Files.WorkingProxies)
+			profile.WorkingProxies = strings.TrimSuffix(c.Files.WorkingProxies, ext) + "." + profile.Name + ext
+		}
+		profiles[i] = profile
+	}
+	return profiles
+}
+
+// GetCheck returns the check with the given name. The preset names can be
+// used without declaring them in the checks section.
+func (c *Config) GetCheck(name string) (CheckConfig, bool) {
+	for _, check := range c.Checks {
+		if check.Name == name {
+			return check, true
+		}
+	}
+
+	switch name {
+	case PresetElevenLabs, PresetHTTPBin:
+		return CheckConfig{Name: name, Preset: name}, true
+	}
+
+	return CheckConfig{}, false
+}
+
+// ResolveHeaders returns the check headers with secret references replaced
+// by the secrets they point to. Values of credential headers are
+// registered for redaction even when they are stored in plaintext.
+func (c CheckConfig) ResolveHeaders() (map[string]string, error) {
+	headers := make(map[string]string, len(c.Headers))
+	for key, value := range c.Headers {
+		resolved, err := secrets.Resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("check %q header %s: %v", c.Name, key, err)
+		}
+		if isCredentialHeader(key) {
+			secrets.Register(resolved)
+			// Also mask the credential alone, as in "Bearer <token>"
+			if _, credential, ok := strings.Cut(resolved, " "); ok {
+				secrets.Register(strings.TrimSpace(credential))
+			}
+		}
+		headers[key] = resolved
+	}
+	return headers, nil
+}
+
+// isCredentialHeader reports whether a header carries credentials, such as
+// Authorization, Cookie or X-Api-Key
+func isCredentialHeader(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "authorization", "proxy-authorization", "cookie":
+		return true
+	}
+	for _, part := range []string{"api-key", "apikey", "api_key", "token", "secret"} {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// ElevenLabsKey returns the ElevenLabs API key with secret references
+// resolved. The key is registered for redaction even when it is stored in
+// plaintext.
+func (c *Config) ElevenLabsKey() (string, error) {
+	key, err := secrets.Resolve(c.API.ElevenLabs.Key)
+	if err != nil {
+		return "", fmt.Errorf("api.elevenlabs.key: %v", err)
+	}
+	if key == "" || key == "your-elevenlabs-api-key-here" {
+		return "", fmt.Errorf("please set your ElevenLabs API key in the config file")
+	}
+
+	secrets.Register(key)
+	return key, nil
+}
+
+// ServerToken returns the bearer token the HTTP API requires, with secret
+// references resolved. An empty token leaves the API open.
+func (c *Config) ServerToken() (string, error) {
+	token, err := secrets.Resolve(c.Server.Token)
+	if err != nil {
+		return "", fmt.Errorf("server.token: %v", err)
+	}
+	if token != "" {
+		secrets.Register(token)
+	}
+	return token, nil
+}
+
+// GetCheckTimeout returns the timeout of a check, falling back to the
+// daemon timeout
+func (c *Config) GetCheckTimeout(check CheckConfig) time.Duration {
+	if check.Timeout > 0 {
+		return time.Duration(check.Timeout) * time.Second
+	}
+	return c.GetTimeout()
+}
+
 // GetInterval returns the daemon interval as time.Duration
 func (c *Config) GetInterval() time.Duration {
 	return time.Duration(c.Daemon.Interval) * time.Second
@@ -110,6 +636,58 @@ func (c *Config) GetSourcesRefreshInterval() time.Duration {
 	return time.Duration(c.Proxy.SourcesRefreshInterval) * time.Second
 }
 
+// GetPrefilterTimeout returns the prefilter handshake timeout as time.Duration
+func (c *Config) GetPrefilterTimeout() time.Duration {
+	return time.Duration(c.Prefilter.Timeout) * time.Second
+}
+
+// GetThroughputTimeout returns the throughput test timeout as time.Duration
+func (c *Config) GetThroughputTimeout() time.Duration {
+	return time.Duration(c.Throughput.Timeout) * time.Second
+}
+
+// GetFullCheckInterval returns how often the light ElevenLabs check runs a
+// full synthesis cycle as time.Duration
+func (c *Config) GetFullCheckInterval() time.Duration {
+	return time.Duration(c.API.ElevenLabs.FullCheckInterval) * time.Second
+}
+
+// GetGeoIPFiles returns the paths of the country, city and ASN databases.
+// Databases without an explicit path are looked for in geoip.path.
+func (c *Config) GetGeoIPFiles() (country, city, asn string) {
+	pick := func(explicit, name string) string {
+		if explicit != "" {
+			return explicit
+		}
+		return filepath.Join(c.GeoIP.Path, name)
+	}
+	return pick(c.GeoIP.CountryDB, "GeoLite2-Country.mmdb"),
+		pick(c.GeoIP.CityDB, "GeoLite2-City.mmdb"),
+		pick(c.GeoIP.ASNDB, "GeoLite2-ASN.mmdb")
+}
+
+// GetExitIPTimeout returns the exit IP judge timeout as time.Duration
+func (c *Config) GetExitIPTimeout() time.Duration {
+	return time.Duration(c.ExitIP.Timeout) * time.Second
+}
+
+// GetStabilityWindow returns the window stability samples are spread over
+// as time.Duration
+func (c *Config) GetStabilityWindow() time.Duration {
+	return time.Duration(c.Stability.Window) * time.Second
+}
+
+// GetLeaseTTL returns how long a leased proxy is reserved as time.Duration
+func (c *Config) GetLeaseTTL() time.Duration {
+	return time.Duration(c.Lease.TTL) * time.Second
+}
+
+// GetSuspectInterval returns how often suspect proxies are retested as
+// time.Duration
+func (c *Config) GetSuspectInterval() time.Duration {
+	return time.Duration(c.Lifecycle.SuspectInterval) * time.Second
+}
+
 // GetMongoTimeout returns the MongoDB connection timeout as time.Duration
 func (c *Config) GetMongoTimeout() time.Duration {
 	return time.Duration(c.MongoDB.Timeout) * time.Second
@@ -0,0 +1,178 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AdaptiveLimiter adjusts how many tests may run at once, AIMD-style. The
+// limit grows additively while throughput holds up and is halved as soon as
+// errors show that the local machine is running out of sockets or file
+// descriptors.
+type AdaptiveLimiter struct {
+	mu       sync.Mutex
+	wake     chan struct{}
+	min      int
+	max      int
+	step     int
+	limit    int
+	inFlight int
+	now      func() time.Time // replaced by tests
+
+	// Current adjustment window
+	windowStart time.Time
+	completed   int
+	localErrors int
+	lastRate    float64
+}
+
+// NewAdaptiveLimiter creates a limiter that starts at start concurrent
+// tests and stays within [min, max]
+func NewAdaptiveLimiter(min, max, start int) *AdaptiveLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if start < min {
+		start = min
+	}
+	if start > max {
+		start = max
+	}
+
+	// Grow by 5% of the range per window so large ranges converge quickly
+	step := (max - min) / 20
+	if step < 1 {
+		step = 1
+	}
+
+	return &AdaptiveLimiter{
+		wake:        make(chan struct{}),
+		min:         min,
+		max:         max,
+		step:        step,
+		limit:       start,
+		now:         time.Now,
+		windowStart: time.Now(),
+	}
+}
+
+// Acquire waits for a free slot. It returns false if ctx is done first.
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) bool {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return true
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Release frees a slot and feeds the outcome of the test into the limit
+func (l *AdaptiveLimiter) Release(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.completed++
+
+	if IsLocalError(err) {
+		l.localErrors++
+
+		// Multiplicative decrease, at most once per window
+		if l.localErrors == 1 {
+			l.setLimit(l.limit / 2)
+		}
+	}
+
+	// A window is one full round of tests at the current limit
+	if l.completed >= l.limit {
+		l.adjust()
+	}
+
+	l.broadcast()
+}
+
+// adjust ends the current window and grows or shrinks the limit based on
+// the window's throughput
+func (l *AdaptiveLimiter) adjust() {
+	elapsed := l.now().Sub(l.windowStart).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(l.completed) / elapsed
+	}
+
+	switch {
+	case l.localErrors > 0:
+		// Already decreased when the error was seen
+	case l.lastRate > 0 && rate < l.lastRate*0.9:
+		// More concurrency made things slower, back off a step
+		l.setLimit(l.limit - l.step)
+	default:
+		l.setLimit(l.limit + l.step)
+	}
+
+	l.lastRate = rate
+	l.windowStart = l.now()
+	l.completed = 0
+	l.localErrors = 0
+}
+
+// setLimit clamps the limit to the configured bounds
+func (l *AdaptiveLimiter) setLimit(limit int) {
+	if limit < l.min {
+		limit = l.min
+	}
+	if limit > l.max {
+		limit = l.max
+	}
+	l.limit = limit
+}
+
+// broadcast wakes all goroutines waiting in Acquire
+func (l *AdaptiveLimiter) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// Limit returns the current concurrency limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Max returns the upper bound of the concurrency limit
+func (l *AdaptiveLimiter) Max() int {
+	return l.max
+}
+
+// RunAdaptivePool runs work on every item like RunPool, but only lets as
+// many items run at once as the limiter allows. errOf extracts the error
+// from a result so the limiter can react to local failures.
+func RunAdaptivePool[T, R any](ctx context.Context, items []T, limiter *AdaptiveLimiter, work func(context.Context, T) R, errOf func(R) error, collect func(R)) {
+	limited := func(ctx context.Context, item T) R {
+		// Without a slot the context is done and work fails fast
+		if !limiter.Acquire(ctx) {
+			return work(ctx, item)
+		}
+
+		result := work(ctx, item)
+		limiter.Release(errOf(result))
+		return result
+	}
+
+	RunPool(ctx, items, limiter.Max(), limited, collect)
+}
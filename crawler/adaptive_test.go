@@ -0,0 +1,221 @@
+package crawler
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// localErr is an error the limiter treats as the local machine running out
+// of file descriptors
+var localErr = os.NewSyscallError("socket", syscall.EMFILE)
+
+// testLimiter returns a limiter whose clock only moves when the returned
+// function is called
+func testLimiter(min, max, start int) (*AdaptiveLimiter, func(time.Duration)) {
+	l := NewAdaptiveLimiter(min, max, start)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.windowStart = now
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+// runWindow completes one full window of tests at the current limit that
+// took elapsed in total, failing the first errors of them with a local error
+func runWindow(t *testing.T, l *AdaptiveLimiter, advance func(time.Duration), elapsed time.Duration, errors int) {
+	t.Helper()
+	n := l.Limit()
+	for i := 0; i < n; i++ {
+		if !l.Acquire(context.Background()) {
+			t.Fatal("Acquire failed")
+		}
+	}
+	advance(elapsed)
+	for i := 0; i < n; i++ {
+		var err error
+		if i < errors {
+			err = localErr
+		}
+		l.Release(err)
+	}
+}
+
+func TestNewAdaptiveLimiterBounds(t *testing.T) {
+	tests := []struct {
+		min, max, start int
+		want            int
+		wantMax         int
+	}{
+		{5, 200, 20, 20, 200},
+		{5, 200, 1, 5, 200},
+		{5, 200, 500, 200, 200},
+		{0, 0, 0, 1, 1},
+		{10, 5, 7, 10, 10},
+	}
+	for _, tt := range tests {
+		l := NewAdaptiveLimiter(tt.min, tt.max, tt.start)
+		if l.Limit() != tt.want || l.Max() != tt.wantMax {
+			t.Errorf("NewAdaptiveLimiter(%d, %d, %d): limit %d of %d, want %d of %d",
+				tt.min, tt.max, tt.start, l.Limit(), l.Max(), tt.want, tt.wantMax)
+		}
+	}
+}
+
+func TestAdaptiveLimiterAdditiveIncrease(t *testing.T) {
+	// A step is 5% of the range: 4
+	l, advance := testLimiter(1, 100, 10)
+
+	// Each window at the higher limit finishes in the same time, so the
+	// rate keeps rising and so does the limit
+	for _, want := range []int{14, 18, 22, 26} {
+		runWindow(t, l, advance, time.Second, 0)
+		if l.Limit() != want {
+			t.Fatalf("limit %d, want %d", l.Limit(), want)
+		}
+	}
+
+	// A window that is much slower than the last backs off a step
+	runWindow(t, l, advance, 10*time.Second, 0)
+	if l.Limit() != 22 {
+		t.Errorf("limit %d after a slow window, want 22", l.Limit())
+	}
+}
+
+func TestAdaptiveLimiterMultiplicativeDecrease(t *testing.T) {
+	l, advance := testLimiter(1, 100, 40)
+
+	// The first local error halves the limit at once, more errors in the
+	// same window do not
+	l.Acquire(context.Background())
+	l.Acquire(context.Background())
+	l.Release(localErr)
+	if l.Limit() != 20 {
+		t.Fatalf("limit %d after a local error, want 20", l.Limit())
+	}
+	l.Release(localErr)
+	if l.Limit() != 20 {
+		t.Fatalf("limit %d after a second error in the window, want 20", l.Limit())
+	}
+
+	// Other failures are the proxy's fault and keep the limit
+	l, advance = testLimiter(1, 100, 40)
+	runWindow(t, l, advance, time.Second, 0)
+	l.Acquire(context.Background())
+	l.Release(os.NewSyscallError("connect", syscall.ECONNREFUSED))
+	if l.Limit() != 44 {
+		t.Errorf("limit %d after a refused connection, want 44", l.Limit())
+	}
+}
+
+func TestAdaptiveLimiterStaysInBounds(t *testing.T) {
+	l, advance := testLimiter(5, 20, 10)
+	for i := 0; i < 10; i++ {
+		runWindow(t, l, advance, time.Second, 1)
+		if l.Limit() < 5 {
+			t.Fatalf("limit %d below the minimum", l.Limit())
+		}
+	}
+	if l.Limit() != 5 {
+		t.Errorf("limit %d after windows of errors, want the minimum 5", l.Limit())
+	}
+
+	for i := 0; i < 20; i++ {
+		runWindow(t, l, advance, time.Second, 0)
+		if l.Limit() > 20 {
+			t.Fatalf("limit %d above the maximum", l.Limit())
+		}
+	}
+	if l.Limit() != 20 {
+		t.Errorf("limit %d after clean windows, want the maximum 20", l.Limit())
+	}
+}
+
+func TestAdaptiveLimiterAcquireWaits(t *testing.T) {
+	l := NewAdaptiveLimiter(1, 1, 1)
+	if !l.Acquire(context.Background()) {
+		t.Fatal("Acquire of a free slot failed")
+	}
+
+	// A full limiter gives up when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if l.Acquire(ctx) {
+		t.Fatal("Acquire of a full limiter succeeded")
+	}
+
+	// and wakes waiters when a slot is released
+	acquired := make(chan bool)
+	go func() { acquired <- l.Acquire(context.Background()) }()
+	l.Release(nil)
+	select {
+	case ok := <-acquired:
+		if !ok {
+			t.Fatal("waiting Acquire failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting Acquire was not woken by Release")
+	}
+}
+
+func TestRunAdaptivePool(t *testing.T) {
+	items := benchAddresses(500)
+	l := NewAdaptiveLimiter(2, 16, 8)
+
+	var inFlight, peak atomic.Int64
+	work := func(ctx context.Context, address string) error {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Microsecond)
+		return localErr
+	}
+	collected := 0
+	RunAdaptivePool(context.Background(), items, l, work, func(err error) error { return err }, func(error) {
+		collected++
+	})
+
+	if collected != len(items) {
+		t.Errorf("collected %d results, want %d", collected, len(items))
+	}
+	if peak.Load() > 16 {
+		t.Errorf("%d tests ran at once, above the maximum 16", peak.Load())
+	}
+	// Every test failed locally, so the limit sank to the minimum
+	if l.Limit() != 2 {
+		t.Errorf("limit %d, want the minimum 2", l.Limit())
+	}
+}
+
+func TestRunAdaptivePoolCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	// One test holds the only slot until the context is done, the workers
+	// waiting for a slot then run their item with the canceled context
+	l := NewAdaptiveLimiter(1, 4, 1)
+	collected := 0
+	RunAdaptivePool(ctx, benchAddresses(20), l, func(ctx context.Context, address string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(err error) error { return err }, func(err error) {
+		if err != context.Canceled {
+			t.Errorf("result %v, want canceled", err)
+		}
+		collected++
+	})
+
+	if collected == 0 || collected > 20 {
+		t.Errorf("collected %d results", collected)
+	}
+	if l.inFlight != 0 {
+		t.Errorf("%d slots still taken", l.inFlight)
+	}
+}
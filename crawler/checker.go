@@ -0,0 +1,197 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Checker tests whether a single proxy works for a particular purpose, such
+// as reaching httpbin or calling the ElevenLabs API through it
+type Checker interface {
+	// Name identifies the check in logs, stats and config
+	Name() string
+
+	// Check tests a single proxy
+	Check(ctx context.Context, proxy string) CheckResult
+}
+
+// CycleChecker is implemented by checks that behave differently from one
+// test cycle to the next. BeginCycle is called before each cycle.
+type CycleChecker interface {
+	BeginCycle()
+}
+
+// UsageReporter is implemented by checks that spend a quota on the target.
+// TakeUsage returns the units consumed since the last call and resets the
+// count.
+type UsageReporter interface {
+	TakeUsage() int64
+}
+
+// CheckResult represents the result of testing a proxy with a Checker
+type CheckResult struct {
+	Proxy string
+	// Type is the protocol the proxy was tested with, as set on the
+	// context with WithProxyTypes. It is empty when the caller set none.
+	Type        ProxyType
+	Check       string
+	IsWorking   bool
+	StatusCode  int
+	Latency     time.Duration
+	Error       error
+	ErrorClass  ErrorClass
+	ResponseLen int
+	// ExitIP is the address the proxy egressed from, when known
+	ExitIP string
+	// Stability is set when the proxy was sampled repeatedly
+	Stability *StabilityStats
+}
+
+// TargetResult is the outcome of one check in a proxy's reachability matrix
+type TargetResult struct {
+	IsWorking  bool
+	StatusCode int
+	Latency    time.Duration
+	ErrorClass ErrorClass
+}
+
+// NewTargetResult returns the matrix entry for a check result
+func NewTargetResult(result CheckResult) TargetResult {
+	return TargetResult{
+		IsWorking:  result.IsWorking,
+		StatusCode: result.StatusCode,
+		Latency:    result.Latency,
+		ErrorClass: result.ErrorClass,
+	}
+}
+
+// Runner runs a Checker against many proxies concurrently
+type Runner struct {
+	maxWorkers int
+	limiter    *AdaptiveLimiter
+
+	// Abort after this many target-side errors, 0 never aborts
+	breakerThreshold int
+}
+
+// TargetRejectedError is returned when a run was aborted because the target
+// rejected our credentials or account rather than the proxies
+type TargetRejectedError struct {
+	Check string
+	Count int
+	Last  error
+}
+
+// Error describes why the run was aborted
+func (e *TargetRejectedError) Error() string {
+	return fmt.Sprintf("check %s aborted after %d target-side errors: %v", e.Check, e.Count, e.Last)
+}
+
+// Unwrap returns the last target-side error
+func (e *TargetRejectedError) Unwrap() error {
+	return e.Last
+}
+
+// NewRunner creates a runner that tests at most maxWorkers proxies at once
+func NewRunner(maxWorkers int) *Runner {
+	return &Runner{
+		maxWorkers: maxWorkers,
+	}
+}
+
+// SetMaxWorkers sets the maximum number of concurrent workers
+func (r *Runner) SetMaxWorkers(workers int) {
+	r.maxWorkers = workers
+}
+
+// SetLimiter makes the runner adapt its concurrency with limiter instead of
+// using a fixed number of workers
+func (r *Runner) SetLimiter(limiter *AdaptiveLimiter) {
+	r.limiter = limiter
+}
+
+// SetBreakerThreshold makes runs abort once threshold results failed with a
+// target-side error. Zero disables the breaker.
+func (r *Runner) SetBreakerThreshold(threshold int) {
+	r.breakerThreshold = threshold
+}
+
+// Concurrency returns the number of proxies currently tested at once
+func (r *Runner) Concurrency() int {
+	if r.limiter != nil {
+		return r.limiter.Limit()
+	}
+	return r.maxWorkers
+}
+
+// Run tests all proxies with checker and returns the results in completion
+// order. If the breaker trips, the results so far are returned with a
+// *TargetRejectedError.
+func (r *Runner) Run(ctx context.Context, checker Checker, proxies []string) ([]CheckResult, error) {
+	results := make([]CheckResult, 0, len(proxies))
+	err := r.RunFunc(ctx, checker, proxies, func(result CheckResult) {
+		results = append(results, result)
+	})
+	return results, err
+}
+
+// RunFunc tests all proxies with checker and calls collect on the calling
+// goroutine for each result as it completes. Once the breaker trips the
+// remaining proxies are skipped and a *TargetRejectedError is returned.
+func (r *Runner) RunFunc(ctx context.Context, checker Checker, proxies []string, collect func(CheckResult)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var rejected *TargetRejectedError
+	guarded := func(result CheckResult) {
+		if result.Type == "" {
+			result.Type = ProxyTypeOf(ctx, result.Proxy)
+		}
+		if r.breakerThreshold > 0 && result.ErrorClass.IsTargetSide() {
+			if rejected == nil {
+				rejected = &TargetRejectedError{Check: checker.Name()}
+			}
+			rejected.Count++
+			rejected.Last = result.Error
+			if rejected.Count == r.breakerThreshold {
+				cancel()
+			}
+		}
+		collect(result)
+	}
+
+	if r.limiter != nil {
+		errOf := func(result CheckResult) error { return result.Error }
+		RunAdaptivePool(ctx, proxies, r.limiter, checker.Check, errOf, guarded)
+	} else {
+		RunPool(ctx, proxies, r.maxWorkers, checker.Check, guarded)
+	}
+
+	if rejected != nil && rejected.Count >= r.breakerThreshold {
+		return rejected
+	}
+	return nil
+}
+
+// GetWorkingProxies returns the addresses of the working proxies in results
+func GetWorkingProxies(results []CheckResult) []string {
+	var working []string
+	for _, result := range results {
+		if result.IsWorking {
+			working = append(working, result.Proxy)
+		}
+	}
+	return working
+}
+
+// CountErrorClasses counts the failed results by error class
+func CountErrorClasses(results []CheckResult) ErrorClassCounts {
+	counts := make(ErrorClassCounts)
+	for _, result := range results {
+		if !result.IsWorking {
+			counts[result.ErrorClass]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// proxyTypesKey is the context key of the proxy protocols set by
+// WithProxyTypes
+type proxyTypesKey struct{}
+
+// WithProxyTypes returns a context that tells checkers which protocol each
+// proxy speaks. Proxies missing from types are treated as HTTP proxies.
+func WithProxyTypes(ctx context.Context, types map[string]ProxyType) context.Context {
+	return context.WithValue(ctx, proxyTypesKey{}, types)
+}
+
+// ProxyTypeOf returns the protocol set for proxy on ctx, or "" when it is
+// not known
+func ProxyTypeOf(ctx context.Context, proxy string) ProxyType {
+	types, _ := ctx.Value(proxyTypesKey{}).(map[string]ProxyType)
+	return types[proxy]
+}
+
+// NewProxyTransport creates a transport that sends every request through
+// proxy without reusing connections. The protocol set for the proxy on ctx
+// is spoken, HTTP by default.
+func NewProxyTransport(ctx context.Context, proxy string, timeout time.Duration) (*http.Transport, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	transport := &http.Transport{
+		DialContext:       dialer.DialContext,
+		DisableKeepAlives: true,
+	}
+
+	switch ProxyTypeOf(ctx, proxy) {
+	case SOCKS4:
+		// net/http only speaks SOCKS5, so SOCKS4 tunnels are dialed here
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, "tcp", proxy)
+			if err != nil {
+				return nil, err
+			}
+			conn.SetDeadline(time.Now().Add(timeout))
+			if err := socks4Connect(conn, addr); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			conn.SetDeadline(time.Time{})
+			return conn, nil
+		}
+	case SOCKS5:
+		proxyURL, err := url.Parse("socks5://" + proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	default:
+		proxyURL, err := url.Parse("http://" + proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return transport, nil
+}
+
+// NewProxyClient creates an HTTP client that sends every request through
+// the given proxy without reusing connections
+func NewProxyClient(ctx context.Context, proxy string, timeout time.Duration) (*http.Client, error) {
+	transport, err := NewProxyTransport(ctx, proxy, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"sort"
@@ -23,6 +24,29 @@ type ProxySource struct {
 	Pattern string
 }
 
+// Type returns the protocol of the proxies the source lists, taken from
+// the protocol parameter of API sources or the path of lists such as
+// socks5.txt. Sources of mixed or unnamed lists count as HTTP.
+func (s ProxySource) Type() ProxyType {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return HTTP
+	}
+
+	name := strings.ToLower(u.Query().Get("protocol"))
+	if name == "" {
+		name = strings.ToLower(u.Path)
+	}
+	switch {
+	case strings.Contains(name, "socks5"):
+		return SOCKS5
+	case strings.Contains(name, "socks4"):
+		return SOCKS4
+	default:
+		return HTTP
+	}
+}
+
 // ProxyResponse represents the response from a JSON API
 type ProxyResponse struct {
 	Data    []ProxyItem `json:"data"`
@@ -42,6 +66,11 @@ type Crawler struct {
 	userAgent  string
 	maxWorkers int
 	timeout    time.Duration
+
+	// origins maps each proxy of the last crawl to the first source, in
+	// source order, that listed it
+	originsMu sync.RWMutex
+	origins   map[string]ProxySource
 }
 
 // NewCrawler creates a new proxy crawler
@@ -74,15 +103,16 @@ func (c *Crawler) CrawlProxies(ctx context.Context) ([]string, error) {
 	startTime := time.Now()
 
 	allProxies := make(map[string]bool)
+	origins := make(map[string]int)
 	var mu sync.Mutex
 
 	// Create a channel to limit concurrent workers
 	semaphore := make(chan struct{}, c.maxWorkers)
 	var wg sync.WaitGroup
 
-	for _, source := range c.sources {
+	for i, source := range c.sources {
 		wg.Add(1)
-		go func(src ProxySource) {
+		go func(index int, src ProxySource) {
 			defer wg.Done()
 
 			// Acquire semaphore
@@ -98,15 +128,25 @@ func (c *Crawler) CrawlProxies(ctx context.Context) ([]string, error) {
 			mu.Lock()
 			for _, proxy := range proxies {
 				allProxies[proxy] = true
+				if first, ok := origins[proxy]; !ok || index < first {
+					origins[proxy] = index
+				}
 			}
 			mu.Unlock()
 
 			fmt.Printf("✓ %s: %d proxies\n", src.URL, len(proxies))
-		}(source)
+		}(i, source)
 	}
 
 	wg.Wait()
 
+	c.originsMu.Lock()
+	c.origins = make(map[string]ProxySource, len(origins))
+	for proxy, index := range origins {
+		c.origins[proxy] = c.sources[index]
+	}
+	c.originsMu.Unlock()
+
 	// Convert map to slice and validate
 	var validProxies []string
 	for proxy := range allProxies {
@@ -126,6 +166,26 @@ func (c *Crawler) CrawlProxies(ctx context.Context) ([]string, error) {
 	return validProxies, nil
 }
 
+// SourceOf returns the URL of the source a proxy of the last crawl came
+// from, or "" for proxies it did not find
+func (c *Crawler) SourceOf(proxy string) string {
+	c.originsMu.RLock()
+	defer c.originsMu.RUnlock()
+	return c.origins[proxy].URL
+}
+
+// TypeOf returns the protocol a proxy of the last crawl was listed under,
+// or "" for proxies it did not find
+func (c *Crawler) TypeOf(proxy string) ProxyType {
+	c.originsMu.RLock()
+	defer c.originsMu.RUnlock()
+	source, ok := c.origins[proxy]
+	if !ok {
+		return ""
+	}
+	return source.Type()
+}
+
 // fetchProxiesFromSource fetches proxies from a single source
 func (c *Crawler) fetchProxiesFromSource(ctx context.Context, source ProxySource) []string {
 	req, err := http.NewRequestWithContext(ctx, "GET", source.URL, nil)
@@ -0,0 +1,169 @@
+package crawler
+
+import (
+	"math"
+	"net"
+	"sort"
+)
+
+// DiversityRules constrain which proxies make up a kept set. Zero values
+// disable a rule.
+type DiversityRules struct {
+	// MaxPerSubnet caps proxies per /24 (IPv4) or /48 (IPv6) entry subnet
+	MaxPerSubnet int
+	// MaxPerASN caps proxies per autonomous system
+	MaxPerASN int
+	// MaxPerExitIP caps proxies per exit IP
+	MaxPerExitIP int
+	// MaxCountryShare caps the share of the set from one country, 0 to 1.
+	// At least one proxy per country is always allowed.
+	MaxCountryShare float64
+	// MinTypeShare is the share of the set that should be of each type,
+	// such as 0.2 for SOCKS5
+	MinTypeShare map[ProxyType]float64
+}
+
+// SelectDiverse picks up to size proxies from ranked, which is sorted
+// best first, such that the set satisfies rules. It is greedy: first the
+// best proxies of each type with a minimum share are reserved, then the
+// set is filled in rank order, skipping proxies that would break a cap.
+// The result keeps the rank order. shortfall reports how many proxies of
+// each type were missing to reach its minimum share.
+func SelectDiverse(ranked []ProxyInfo, size int, rules DiversityRules) (selected []ProxyInfo, shortfall map[ProxyType]int) {
+	if size <= 0 {
+		return nil, nil
+	}
+
+	counter := newDiversityCounter(rules, size)
+	chosen := make([]bool, len(ranked))
+	count := 0
+
+	// Reserve the minimum share of each type, largest quota first so the
+	// order does not depend on map iteration
+	types := make([]ProxyType, 0, len(rules.MinTypeShare))
+	for proxyType := range rules.MinTypeShare {
+		types = append(types, proxyType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		si, sj := rules.MinTypeShare[types[i]], rules.MinTypeShare[types[j]]
+		if si != sj {
+			return si > sj
+		}
+		return types[i] < types[j]
+	})
+
+	for _, proxyType := range types {
+		quota := int(math.Ceil(rules.MinTypeShare[proxyType] * float64(size)))
+		have := 0
+		for i, proxy := range ranked {
+			if have >= quota || count >= size {
+				break
+			}
+			if chosen[i] || proxy.Type != proxyType || !counter.allows(proxy) {
+				continue
+			}
+			counter.add(proxy)
+			chosen[i] = true
+			have++
+			count++
+		}
+		if have < quota {
+			if shortfall == nil {
+				shortfall = make(map[ProxyType]int)
+			}
+			shortfall[proxyType] = quota - have
+		}
+	}
+
+	// Fill the rest in rank order
+	for i, proxy := range ranked {
+		if count >= size {
+			break
+		}
+		if chosen[i] || !counter.allows(proxy) {
+			continue
+		}
+		counter.add(proxy)
+		chosen[i] = true
+		count++
+	}
+
+	selected = make([]ProxyInfo, 0, count)
+	for i, proxy := range ranked {
+		if chosen[i] {
+			selected = append(selected, proxy)
+		}
+	}
+	return selected, shortfall
+}
+
+// diversityCounter tracks how many selected proxies share each key
+type diversityCounter struct {
+	rules      DiversityRules
+	maxCountry int
+	subnets    map[string]int
+	asns       map[uint]int
+	exitIPs    map[string]int
+	countries  map[string]int
+}
+
+func newDiversityCounter(rules DiversityRules, size int) *diversityCounter {
+	maxCountry := 0
+	if rules.MaxCountryShare > 0 {
+		maxCountry = max(int(rules.MaxCountryShare*float64(size)), 1)
+	}
+	return &diversityCounter{
+		rules:      rules,
+		maxCountry: maxCountry,
+		subnets:    make(map[string]int),
+		asns:       make(map[uint]int),
+		exitIPs:    make(map[string]int),
+		countries:  make(map[string]int),
+	}
+}
+
+// allows reports whether adding proxy keeps every cap. Unknown subnets,
+// ASNs, exit IPs and countries are not capped.
+func (c *diversityCounter) allows(proxy ProxyInfo) bool {
+	if subnet := SubnetKey(proxy.IP); c.rules.MaxPerSubnet > 0 && subnet != "" && c.subnets[subnet] >= c.rules.MaxPerSubnet {
+		return false
+	}
+	if c.rules.MaxPerASN > 0 && proxy.ASN != 0 && c.asns[proxy.ASN] >= c.rules.MaxPerASN {
+		return false
+	}
+	if c.rules.MaxPerExitIP > 0 && proxy.ExitIP != "" && c.exitIPs[proxy.ExitIP] >= c.rules.MaxPerExitIP {
+		return false
+	}
+	if c.maxCountry > 0 && proxy.Country != "" && c.countries[proxy.Country] >= c.maxCountry {
+		return false
+	}
+	return true
+}
+
+func (c *diversityCounter) add(proxy ProxyInfo) {
+	if subnet := SubnetKey(proxy.IP); subnet != "" {
+		c.subnets[subnet]++
+	}
+	if proxy.ASN != 0 {
+		c.asns[proxy.ASN]++
+	}
+	if proxy.ExitIP != "" {
+		c.exitIPs[proxy.ExitIP]++
+	}
+	if proxy.Country != "" {
+		c.countries[proxy.Country]++
+	}
+}
+
+// SubnetKey returns the /24 of an IPv4 address or the /48 of an IPv6
+// address, or "" if ip does not parse
+func SubnetKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
@@ -0,0 +1,185 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// ErrorClass categorises why a proxy test failed
+type ErrorClass string
+
+const (
+	ClassNone           ErrorClass = ""
+	ClassDNS            ErrorClass = "dns"
+	ClassConnRefused    ErrorClass = "connect_refused"
+	ClassConnTimeout    ErrorClass = "connect_timeout"
+	ClassProxyAuth      ErrorClass = "proxy_auth"
+	ClassProxyHandshake ErrorClass = "proxy_handshake"
+	ClassTLS            ErrorClass = "tls"
+	ClassHTTPStatus     ErrorClass = "http_status"
+	ClassBodyValidation ErrorClass = "body_validation"
+	ClassTargetAuth     ErrorClass = "target_auth"
+	ClassUnstable       ErrorClass = "unstable"
+	ClassCanceled       ErrorClass = "canceled"
+	ClassUnknown        ErrorClass = "unknown"
+)
+
+// TestError is a test failure tagged with its error class
+type TestError struct {
+	Class ErrorClass
+	Err   error
+}
+
+// Error returns the underlying error message
+func (e *TestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *TestError) Unwrap() error {
+	return e.Err
+}
+
+// NewTestError tags an error with a class
+func NewTestError(class ErrorClass, err error) error {
+	return &TestError{Class: class, Err: err}
+}
+
+// IsTargetSide reports whether the class describes a problem with our
+// account on the target, such as a revoked key or exhausted quota. These
+// failures say nothing about the proxy.
+func (c ErrorClass) IsTargetSide() bool {
+	return c == ClassTargetAuth
+}
+
+// ClassifyStatus returns the error class for a non-2xx HTTP status
+func ClassifyStatus(statusCode int) ErrorClass {
+	if statusCode == http.StatusProxyAuthRequired {
+		return ClassProxyAuth
+	}
+	return ClassHTTPStatus
+}
+
+// ClassifyError maps an error returned while testing a proxy to its class
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ClassNone
+	}
+
+	var testErr *TestError
+	if errors.As(err, &testErr) {
+		return testErr.Class
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ClassCanceled
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ClassDNS
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ClassConnRefused
+	}
+
+	// net/http reports a failed CONNECT with the proxy's status text
+	msg := err.Error()
+	if strings.Contains(msg, "Proxy Authentication Required") {
+		return ClassProxyAuth
+	}
+
+	if isTLSError(err) {
+		return ClassTLS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ClassConnTimeout
+	}
+
+	// The proxy accepted the connection but hung up, spoke garbage or
+	// refused the SOCKS5 request with a reply code
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		strings.Contains(msg, "proxyconnect") ||
+		strings.Contains(msg, "socks connect") ||
+		strings.Contains(msg, "malformed HTTP") {
+		return ClassProxyHandshake
+	}
+
+	return ClassUnknown
+}
+
+// IsLocalError reports whether err was caused by the local machine running
+// out of resources rather than by the proxy, such as hitting the file
+// descriptor limit or exhausting ephemeral ports
+func IsLocalError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch {
+	case errors.Is(err, syscall.EMFILE),
+		errors.Is(err, syscall.ENFILE),
+		errors.Is(err, syscall.ENOBUFS),
+		errors.Is(err, syscall.EADDRNOTAVAIL),
+		errors.Is(err, syscall.EADDRINUSE),
+		errors.Is(err, syscall.ENETUNREACH):
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "too many open files") ||
+		strings.Contains(msg, "no buffer space available")
+}
+
+// isTLSError reports whether err was caused by the TLS handshake
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &recordErr),
+		errors.As(err, &alertErr),
+		errors.As(err, &verifyErr),
+		errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &invalidErr):
+		return true
+	}
+
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// ErrorClassCounts counts failures by error class
+type ErrorClassCounts map[ErrorClass]int
+
+// String formats the counts as "class=count" pairs sorted by class
+func (c ErrorClassCounts) String() string {
+	classes := make([]string, 0, len(c))
+	for class := range c {
+		classes = append(classes, string(class))
+	}
+	sort.Strings(classes)
+
+	parts := make([]string, len(classes))
+	for i, class := range classes {
+		parts[i] = fmt.Sprintf("%s=%d", class, c[ErrorClass(class)])
+	}
+	return strings.Join(parts, " ")
+}
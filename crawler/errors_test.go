@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// socksReplyError returns the error net/http reports when a SOCKS5 proxy
+// answers the CONNECT request with the given reply code
+func socksReplyError(t *testing.T, code byte) error {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Greeting: version, one method, no authentication
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(conn, greeting); err != nil {
+			return
+		}
+		conn.Write([]byte{0x05, 0x00})
+		// Request for an IPv4 target: version, command, reserved, type,
+		// address and port
+		request := make([]byte, 10)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		conn.Write([]byte{0x05, code, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	}()
+
+	proxyURL, _ := url.Parse("socks5://" + listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get("http://192.0.2.1/")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("reply code %d: request succeeded", code)
+	}
+	return err
+}
+
+func TestClassifyError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"no error", nil, ClassNone},
+		{"tagged", fmt.Errorf("check: %w", NewTestError(ClassTargetAuth, errors.New("invalid api key"))), ClassTargetAuth},
+		{"canceled", fmt.Errorf("request: %w", context.Canceled), ClassCanceled},
+		{"dns", &net.DNSError{Err: "no such host", Name: "proxy.invalid", IsNotFound: true}, ClassDNS},
+		{"refused", refused, ClassConnRefused},
+		{"refused by the proxy", &net.OpError{Op: "proxyconnect", Net: "tcp", Err: refused}, ClassConnRefused},
+		{"dial timeout", timeout, ClassConnTimeout},
+		{"deadline exceeded", fmt.Errorf("request: %w", context.DeadlineExceeded), ClassConnTimeout},
+		{"reset", reset, ClassProxyHandshake},
+		{"broken pipe", os.NewSyscallError("write", syscall.EPIPE), ClassProxyHandshake},
+		{"hung up", fmt.Errorf("read response: %w", io.ErrUnexpectedEOF), ClassProxyHandshake},
+		{"malformed response", errors.New(`net/http: HTTP/1.x transport connection broken: malformed HTTP response "\x05\x00"`), ClassProxyHandshake},
+		{"proxy auth", errors.New("Proxy Authentication Required"), ClassProxyAuth},
+		{"tls record", tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, ClassTLS},
+		{"tls alert", tls.AlertError(40), ClassTLS},
+		{"unknown authority", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, ClassTLS},
+		{"hostname", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "example.com"}, ClassTLS},
+		{"tls message", errors.New("remote error: tls: handshake failure"), ClassTLS},
+		{"unknown", errors.New("something else"), ClassUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifySOCKSReplies(t *testing.T) {
+	// Every failure code a SOCKS5 proxy can reply with means the proxy
+	// answered but would not open the tunnel
+	for code := byte(0x01); code <= 0x09; code++ {
+		err := socksReplyError(t, code)
+		if got := ClassifyError(err); got != ClassProxyHandshake {
+			t.Errorf("reply code %d (%v): %q, want %q", code, err, got, ClassProxyHandshake)
+		}
+	}
+
+	// SOCKS4 replies are checked by our own handshake
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		io.ReadFull(server, make([]byte, 9+len("example.com")+1))
+		server.Write([]byte{0x00, 0x5B, 0, 0, 0, 0, 0, 0})
+	}()
+	if got := ClassifyError(socks4Connect(client, "example.com:80")); got != ClassProxyHandshake {
+		t.Errorf("rejected SOCKS4 request: %q, want %q", got, ClassProxyHandshake)
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   ErrorClass
+	}{
+		{http.StatusProxyAuthRequired, ClassProxyAuth},
+		{http.StatusForbidden, ClassHTTPStatus},
+		{http.StatusTooManyRequests, ClassHTTPStatus},
+		{http.StatusBadGateway, ClassHTTPStatus},
+	}
+	for _, tt := range tests {
+		err := NewTestError(ClassifyStatus(tt.status), fmt.Errorf("HTTP %d", tt.status))
+		if got := ClassifyError(err); got != tt.want {
+			t.Errorf("HTTP %d: %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestIsLocalError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("socket", syscall.EMFILE)}, true},
+		{os.NewSyscallError("connect", syscall.EADDRNOTAVAIL), true},
+		{errors.New("accept tcp: too many open files"), true},
+		{os.NewSyscallError("connect", syscall.ECONNREFUSED), false},
+	}
+	for _, tt := range tests {
+		if got := IsLocalError(tt.err); got != tt.want {
+			t.Errorf("IsLocalError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ExitIPDetector finds the address a proxy egresses from by asking a judge
+// endpoint that echoes the caller's IP, such as httpbin.org/ip or
+// api.ipify.org
+type ExitIPDetector struct {
+	judgeURL   string
+	timeout    time.Duration
+	maxWorkers int
+}
+
+// NewExitIPDetector creates a detector that asks judgeURL for the exit IP
+func NewExitIPDetector(judgeURL string, timeout time.Duration) *ExitIPDetector {
+	return &ExitIPDetector{
+		judgeURL:   judgeURL,
+		timeout:    timeout,
+		maxWorkers: 50,
+	}
+}
+
+// SetMaxWorkers sets the maximum number of concurrent workers
+func (d *ExitIPDetector) SetMaxWorkers(workers int) {
+	d.maxWorkers = workers
+}
+
+// Detect returns the exit IP of a single proxy
+func (d *ExitIPDetector) Detect(ctx context.Context, proxy string) (string, error) {
+	client, err := NewProxyClient(ctx, proxy, d.timeout)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", d.judgeURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("User-Agent", "ProxyTester/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("judge returned HTTP %d", resp.StatusCode)
+	}
+
+	// Judges answer with a few bytes, anything longer is not one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+
+	ip := ParseExitIP(body)
+	if ip == "" {
+		return "", fmt.Errorf("no IP address in judge response")
+	}
+	return ip, nil
+}
+
+// DetectAll detects the exit IP of every proxy concurrently. Proxies whose
+// exit IP could not be detected are left out of the result.
+func (d *ExitIPDetector) DetectAll(ctx context.Context, proxies []string) map[string]string {
+	type detection struct {
+		proxy string
+		ip    string
+	}
+
+	detect := func(ctx context.Context, proxy string) detection {
+		ip, _ := d.Detect(ctx, proxy)
+		return detection{proxy: proxy, ip: ip}
+	}
+
+	exitIPs := make(map[string]string, len(proxies))
+	RunPool(ctx, proxies, d.maxWorkers, detect, func(result detection) {
+		if result.ip != "" {
+			exitIPs[result.proxy] = result.ip
+		}
+	})
+	return exitIPs
+}
+
+// ParseExitIP extracts the caller IP from a judge response. It understands
+// httpbin's {"origin": "..."}, ipify's {"ip": "..."} and plain text. When a
+// proxy forwards the client address, httpbin lists several; the first one
+// is the client and the last one is the exit, so the last is returned.
+func ParseExitIP(body []byte) string {
+	var echo struct {
+		Origin string `json:"origin"`
+		IP     string `json:"ip"`
+	}
+
+	text := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &echo) == nil {
+		text = echo.IP
+		if echo.Origin != "" {
+			text = echo.Origin
+		}
+	}
+
+	parts := strings.Split(text, ",")
+	candidate := strings.TrimSpace(parts[len(parts)-1])
+	if ip := net.ParseIP(candidate); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// CountExitIPs returns the number of distinct exit IPs among proxies
+func CountExitIPs(proxies []string, exitIPs map[string]string) int {
+	distinct := make(map[string]bool)
+	for _, proxy := range proxies {
+		if ip, ok := exitIPs[proxy]; ok {
+			distinct[ip] = true
+		}
+	}
+	return len(distinct)
+}
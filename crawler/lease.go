@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrUnknownLease is returned for lease IDs that were never handed out,
+// have already been reported on or have expired
+var ErrUnknownLease = errors.New("unknown or expired lease")
+
+// Lease is a proxy handed out to a consumer. The proxy counts as in flight
+// until the consumer reports how it went or the lease expires.
+type Lease struct {
+	ID      string
+	Proxy   ProxyInfo
+	Expires time.Time
+}
+
+// leaseEntry is what the manager remembers about an open lease
+type leaseEntry struct {
+	address string
+	expires time.Time
+}
+
+// SetScorer makes reported feedback update the score of leased proxies
+func (pm *ProxyManager) SetScorer(scorer *Scorer) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.scorer = scorer
+}
+
+// SetFailureLimit pulls a proxy from selection after limit consecutive
+// failures reported by consumers. The proxy stays in the manager, marked
+// as not working, until a test stores it as working again. 0 disables
+// pulling.
+func (pm *ProxyManager) SetFailureLimit(limit int) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.failureLimit = limit
+}
+
+// Lease picks a working proxy that passes filter with strategy and hands
+// it out for ttl
+func (pm *ProxyManager) Lease(strategy Strategy, key string, filter Filter, ttl time.Duration) (Lease, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	now := time.Now()
+	pm.expireLeases(now)
+
+	entry, err := pm.selectLocked(strategy, key, filter)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	lease := Lease{
+		ID:      newLeaseID(),
+		Proxy:   entry.info,
+		Expires: now.Add(ttl),
+	}
+	pm.leases[lease.ID] = &leaseEntry{address: entry.info.Address, expires: lease.Expires}
+	return lease, nil
+}
+
+// ReportSuccess closes a lease whose proxy worked in real traffic with the
+// given latency
+func (pm *ProxyManager) ReportSuccess(leaseID string, latency time.Duration) error {
+	return pm.report(leaseID, true, latency, ClassNone)
+}
+
+// ReportFailure closes a lease whose proxy failed in real traffic. Errors
+// on the target's side, such as a rejected API key, close the lease
+// without counting against the proxy.
+func (pm *ProxyManager) ReportFailure(leaseID string, class ErrorClass) error {
+	return pm.report(leaseID, false, 0, class)
+}
+
+// ActiveLeases returns the number of open leases
+func (pm *ProxyManager) ActiveLeases() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.expireLeases(time.Now())
+	return len(pm.leases)
+}
+
+// report closes a lease and applies the feedback to its proxy
+func (pm *ProxyManager) report(leaseID string, working bool, latency time.Duration, class ErrorClass) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	now := time.Now()
+	pm.expireLeases(now)
+
+	lease, ok := pm.leases[leaseID]
+	if !ok {
+		return ErrUnknownLease
+	}
+	delete(pm.leases, leaseID)
+	pm.releaseLocked(lease.address)
+
+	entry, ok := pm.proxies[lease.address]
+	if !ok || (!working && class.IsTargetSide()) {
+		return nil
+	}
+
+	proxy := cloneProxyInfo(entry.info)
+	if pm.scorer != nil {
+		pm.scorer.Observe(&proxy.History, working, latency, class, now)
+		proxy.Score = pm.scorer.Score(proxy.History, now)
+	}
+	if working {
+		proxy.FeedbackFailures = 0
+	} else {
+		proxy.FeedbackFailures++
+		proxy.ErrorClass = class
+		if pm.failureLimit > 0 && proxy.FeedbackFailures >= pm.failureLimit {
+			proxy.IsWorking = false
+		}
+	}
+	pm.store(proxy)
+	return nil
+}
+
+// expireLeases drops leases that ran out, the caller holds the write lock
+func (pm *ProxyManager) expireLeases(now time.Time) {
+	for id, lease := range pm.leases {
+		if now.After(lease.expires) {
+			delete(pm.leases, id)
+			pm.releaseLocked(lease.address)
+		}
+	}
+}
+
+// newLeaseID returns a random lease ID
+func newLeaseID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"math"
+	"time"
+)
+
+// ProxyState is where a proxy stands in its lifecycle
+type ProxyState string
+
+const (
+	// StateCandidate is a crawled proxy that has not been tested yet
+	StateCandidate ProxyState = "candidate"
+	// StateWorking proxies passed their last test and are handed out
+	StateWorking ProxyState = "working"
+	// StateSuspect proxies were working but failed recently. They are not
+	// handed out, but are retested soon instead of being dropped.
+	StateSuspect ProxyState = "suspect"
+	// StateQuarantined proxies kept failing and are retested rarely
+	StateQuarantined ProxyState = "quarantined"
+	// StateDead proxies are only retested after a long backoff
+	StateDead ProxyState = "dead"
+)
+
+// LifecycleParams sets the retest intervals and failure limits of the
+// proxy lifecycle
+type LifecycleParams struct {
+	// Intervals is the base retest interval of each state
+	Intervals map[ProxyState]time.Duration
+	// BackoffFactor multiplies the interval for every further failure in
+	// the same state
+	BackoffFactor float64
+	// MaxInterval caps the backed-off interval
+	MaxInterval time.Duration
+	// SuspectFailures is the number of failed retests after which a
+	// suspect proxy is quarantined
+	SuspectFailures int
+	// QuarantineFailures is the number of failed retests after which a
+	// quarantined proxy is declared dead
+	QuarantineFailures int
+}
+
+// ProxyStatus is the lifecycle state of one proxy
+type ProxyStatus struct {
+	State ProxyState
+	// Since is when the proxy entered State
+	Since time.Time
+	// Failures counts consecutive failed tests in State
+	Failures int
+	// NextTest is when the proxy is due for a retest
+	NextTest time.Time
+}
+
+// Due reports whether the proxy should be tested at the given time
+func (s ProxyStatus) Due(at time.Time) bool {
+	return !at.Before(s.NextTest)
+}
+
+// Lifecycle moves proxies between states as test results come in
+type Lifecycle struct {
+	params LifecycleParams
+}
+
+// NewLifecycle creates a lifecycle with the given parameters
+func NewLifecycle(params LifecycleParams) *Lifecycle {
+	if params.BackoffFactor < 1 {
+		params.BackoffFactor = 1
+	}
+	return &Lifecycle{params: params}
+}
+
+// Observe applies a test result taken at the given time:
+//
+//	candidate   → working on a pass, quarantined on a failure
+//	working     → suspect on a failure
+//	suspect     → working on a pass, quarantined after SuspectFailures
+//	quarantined → working on a pass, dead after QuarantineFailures
+//	dead        → working on a pass
+func (l *Lifecycle) Observe(status *ProxyStatus, working bool, at time.Time) {
+	if status.State == "" {
+		status.State = StateCandidate
+	}
+
+	if working {
+		l.enter(status, StateWorking, at)
+	} else {
+		status.Failures++
+		switch status.State {
+		case StateCandidate:
+			l.enter(status, StateQuarantined, at)
+			status.Failures = 1
+		case StateWorking:
+			l.enter(status, StateSuspect, at)
+			status.Failures = 1
+		case StateSuspect:
+			if status.Failures >= l.params.SuspectFailures {
+				l.enter(status, StateQuarantined, at)
+				status.Failures = 1
+			}
+		case StateQuarantined:
+			if status.Failures >= l.params.QuarantineFailures {
+				l.enter(status, StateDead, at)
+				status.Failures = 1
+			}
+		}
+	}
+
+	status.NextTest = at.Add(l.interval(*status))
+}
+
+// enter moves status to state, keeping Since when the state is unchanged
+func (l *Lifecycle) enter(status *ProxyStatus, state ProxyState, at time.Time) {
+	if status.State != state {
+		status.State = state
+		status.Since = at
+	}
+	status.Failures = 0
+}
+
+// interval returns the backed-off retest interval for status
+func (l *Lifecycle) interval(status ProxyStatus) time.Duration {
+	base := l.params.Intervals[status.State]
+	if status.Failures > 1 {
+		base = time.Duration(float64(base) * math.Pow(l.params.BackoffFactor, float64(status.Failures-1)))
+	}
+	if l.params.MaxInterval > 0 && (base > l.params.MaxInterval || base < 0) {
+		base = l.params.MaxInterval
+	}
+	return base
+}
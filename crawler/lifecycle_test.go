@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+var lifecycleEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testLifecycle() *Lifecycle {
+	return NewLifecycle(LifecycleParams{
+		Intervals: map[ProxyState]time.Duration{
+			StateWorking:     5 * time.Minute,
+			StateSuspect:     time.Minute,
+			StateQuarantined: 15 * time.Minute,
+			StateDead:        24 * time.Hour,
+		},
+		BackoffFactor:      2,
+		MaxInterval:        72 * time.Hour,
+		SuspectFailures:    2,
+		QuarantineFailures: 3,
+	})
+}
+
+// step is one observed test result and the status it should lead to
+type step struct {
+	working  bool
+	state    ProxyState
+	failures int
+	next     time.Duration
+}
+
+func TestLifecycleTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"candidate passes", []step{
+			{true, StateWorking, 0, 5 * time.Minute},
+		}},
+		// A candidate that never worked skips suspect, which is for
+		// proxies with a good record, and is retested rarely
+		{"candidate fails", []step{
+			{false, StateQuarantined, 1, 15 * time.Minute},
+		}},
+		{"working proxy fails down to dead", []step{
+			{true, StateWorking, 0, 5 * time.Minute},
+			{false, StateSuspect, 1, time.Minute},
+			{false, StateQuarantined, 1, 15 * time.Minute},
+			{false, StateQuarantined, 2, 30 * time.Minute},
+			{false, StateDead, 1, 24 * time.Hour},
+			{false, StateDead, 2, 48 * time.Hour},
+			// 96h is capped
+			{false, StateDead, 3, 72 * time.Hour},
+		}},
+		{"suspect recovers", []step{
+			{true, StateWorking, 0, 5 * time.Minute},
+			{false, StateSuspect, 1, time.Minute},
+			{true, StateWorking, 0, 5 * time.Minute},
+		}},
+		{"dead proxy comes back", []step{
+			{false, StateQuarantined, 1, 15 * time.Minute},
+			{false, StateQuarantined, 2, 30 * time.Minute},
+			{false, StateDead, 1, 24 * time.Hour},
+			{true, StateWorking, 0, 5 * time.Minute},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle := testLifecycle()
+			var status ProxyStatus
+			at := lifecycleEpoch
+			for i, s := range tt.steps {
+				lifecycle.Observe(&status, s.working, at)
+				if status.State != s.state || status.Failures != s.failures || status.NextTest != at.Add(s.next) {
+					t.Fatalf("step %d: %s with %d failures due in %v, want %s with %d due in %v", i,
+						status.State, status.Failures, status.NextTest.Sub(at), s.state, s.failures, s.next)
+				}
+				at = status.NextTest
+			}
+		})
+	}
+}
+
+func TestLifecycleSince(t *testing.T) {
+	lifecycle := testLifecycle()
+	var status ProxyStatus
+
+	lifecycle.Observe(&status, true, lifecycleEpoch)
+	lifecycle.Observe(&status, true, lifecycleEpoch.Add(time.Hour))
+	if !status.Since.Equal(lifecycleEpoch) {
+		t.Errorf("since %v, staying in a state must keep it", status.Since)
+	}
+
+	lifecycle.Observe(&status, false, lifecycleEpoch.Add(2*time.Hour))
+	if !status.Since.Equal(lifecycleEpoch.Add(2 * time.Hour)) {
+		t.Errorf("since %v after becoming suspect", status.Since)
+	}
+}
+
+func TestLifecycleDue(t *testing.T) {
+	status := ProxyStatus{NextTest: lifecycleEpoch}
+	if status.Due(lifecycleEpoch.Add(-time.Second)) || !status.Due(lifecycleEpoch) || !status.Due(lifecycleEpoch.Add(time.Second)) {
+		t.Error("Due does not switch at NextTest")
+	}
+	if !(ProxyStatus{}).Due(lifecycleEpoch) {
+		t.Error("a proxy that was never tested is not due")
+	}
+}
+
+func TestLifecycleNoBackoffBelowOne(t *testing.T) {
+	lifecycle := NewLifecycle(LifecycleParams{
+		Intervals:          map[ProxyState]time.Duration{StateQuarantined: time.Minute},
+		BackoffFactor:      0.5,
+		QuarantineFailures: 10,
+	})
+	var status ProxyStatus
+	for i := 0; i < 5; i++ {
+		lifecycle.Observe(&status, false, lifecycleEpoch)
+	}
+	if got := status.NextTest.Sub(lifecycleEpoch); got != time.Minute {
+		t.Errorf("interval %v, a factor below 1 must not shrink it", got)
+	}
+}
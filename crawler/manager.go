@@ -1,10 +1,14 @@
 package crawler
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"regproxy/geoip"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,38 +31,107 @@ type ProxyInfo struct {
 	Country   string
 	Anonymity string
 	Latency   time.Duration
-	LastCheck time.Time
-	IsWorking bool
+	// Throughput is the measured download rate in bytes per second, zero
+	// when no throughput test has been run
+	Throughput float64
+	LastCheck  time.Time
+	IsWorking  bool
+	// ErrorClass is the category of the last failed test
+	ErrorClass ErrorClass
+	// Profiles lists the check profiles the proxy passed
+	Profiles []string
+	// ExitIP is the address the proxy egresses from, which differs from IP
+	// for chained proxies
+	ExitIP string
+	// GeoIP data for IP and ExitIP, filled in by Enrich
+	City        string
+	ASN         uint
+	Org         string
+	ExitCountry string
+	ExitASN     uint
+	ExitOrg     string
+	// Targets holds the last result of each check, keyed by check name
+	Targets map[string]TargetResult
+	// Score is the composite score from the scoring model, 0 to 1, and
+	// History what it was computed from
+	Score   float64
+	History ProxyHistory
+	// LastUsed is when Select last handed the proxy out and InFlight how
+	// many of those uses have not been released yet
+	LastUsed time.Time
+	InFlight int
+	// FeedbackFailures counts failures reported by consumers since the
+	// last reported success or passed test
+	FeedbackFailures int
+	// Source is the URL of the source the proxy was crawled from
+	Source string
 }
 
-// ProxyManager manages proxy operations
+// ProxyManager keeps proxies keyed by address, with indexes by type,
+// country, profile and working status. It is safe for concurrent use, so
+// the daemon can update it while other goroutines query it. Queries
+// return copies in insertion order, which share their Profiles and Targets
+// with the manager and must not be modified.
 type ProxyManager struct {
-	proxies []ProxyInfo
+	mu      sync.RWMutex
+	proxies map[string]*managedProxy
+	nextSeq uint64
+
+	byType    map[ProxyType]map[string]bool
+	byCountry map[string]map[string]bool
+	byProfile map[string]map[string]bool
+	working   map[string]bool
+
+	// Leases handed out to consumers and what their feedback does
+	leases       map[string]*leaseEntry
+	scorer       *Scorer
+	failureLimit int
+}
+
+// managedProxy is a stored proxy with its insertion sequence number
+type managedProxy struct {
+	info ProxyInfo
+	seq  uint64
 }
 
 // NewProxyManager creates a new proxy manager
 func NewProxyManager() *ProxyManager {
-	return &ProxyManager{
-		proxies: make([]ProxyInfo, 0),
-	}
+	pm := &ProxyManager{}
+	pm.reset()
+	return pm
+}
+
+// reset empties the manager, the caller holds the write lock
+func (pm *ProxyManager) reset() {
+	pm.proxies = make(map[string]*managedProxy)
+	pm.byType = make(map[ProxyType]map[string]bool)
+	pm.byCountry = make(map[string]map[string]bool)
+	pm.byProfile = make(map[string]map[string]bool)
+	pm.working = make(map[string]bool)
+	pm.leases = make(map[string]*leaseEntry)
 }
 
-// AddProxy adds a proxy to the manager
+// AddProxy adds a proxy to the manager. Addresses already present are
+// left untouched.
 func (pm *ProxyManager) AddProxy(address string, proxyType ProxyType) {
 	parts := strings.Split(address, ":")
 	if len(parts) != 2 {
 		return
 	}
 
-	proxy := ProxyInfo{
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if _, ok := pm.proxies[address]; ok {
+		return
+	}
+	pm.store(ProxyInfo{
 		Address:   address,
 		IP:        parts[0],
 		Port:      parts[1],
 		Type:      proxyType,
 		LastCheck: time.Now(),
-	}
-
-	pm.proxies = append(pm.proxies, proxy)
+	})
 }
 
 // AddProxies adds multiple proxies to the manager
@@ -68,31 +141,362 @@ func (pm *ProxyManager) AddProxies(addresses []string, proxyType ProxyType) {
 	}
 }
 
+// Upsert stores proxy under its address, replacing any existing entry but
+// keeping its position and usage (LastUsed and InFlight). IP and Port are
+// filled in from the address when empty.
+func (pm *ProxyManager) Upsert(proxy ProxyInfo) error {
+	parts := strings.Split(proxy.Address, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid proxy address %q", proxy.Address)
+	}
+	if proxy.IP == "" {
+		proxy.IP = parts[0]
+	}
+	if proxy.Port == "" {
+		proxy.Port = parts[1]
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if entry, ok := pm.proxies[proxy.Address]; ok {
+		proxy.LastUsed = entry.info.LastUsed
+		proxy.InFlight = entry.info.InFlight
+	}
+	pm.store(cloneProxyInfo(proxy))
+	return nil
+}
+
+// Update applies fn to the stored proxy at address and reindexes it. It
+// reports false when the address is unknown. fn must not keep the
+// pointer, and the address cannot be changed.
+func (pm *ProxyManager) Update(address string, fn func(*ProxyInfo)) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	entry, ok := pm.proxies[address]
+	if !ok {
+		return false
+	}
+
+	// Work on a copy, readers may still hold the old slices and maps
+	proxy := cloneProxyInfo(entry.info)
+	fn(&proxy)
+	proxy.Address = address
+	pm.store(proxy)
+	return true
+}
+
+// Get returns the proxy stored at address
+func (pm *ProxyManager) Get(address string) (ProxyInfo, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	entry, ok := pm.proxies[address]
+	if !ok {
+		return ProxyInfo{}, false
+	}
+	return entry.info, true
+}
+
+// Remove deletes the proxy at address and reports whether it was present
+func (pm *ProxyManager) Remove(address string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	entry, ok := pm.proxies[address]
+	if !ok {
+		return false
+	}
+	pm.unindex(entry.info)
+	delete(pm.proxies, address)
+	return true
+}
+
+// store inserts or replaces a proxy and updates the indexes, the caller
+// holds the write lock
+func (pm *ProxyManager) store(proxy ProxyInfo) {
+	if entry, ok := pm.proxies[proxy.Address]; ok {
+		pm.unindex(entry.info)
+		entry.info = proxy
+	} else {
+		pm.proxies[proxy.Address] = &managedProxy{info: proxy, seq: pm.nextSeq}
+		pm.nextSeq++
+	}
+
+	addToIndex(pm.byType, proxy.Type, proxy.Address)
+	if proxy.Country != "" {
+		addToIndex(pm.byCountry, proxy.Country, proxy.Address)
+	}
+	for _, profile := range proxy.Profiles {
+		addToIndex(pm.byProfile, profile, proxy.Address)
+	}
+	if proxy.IsWorking {
+		pm.working[proxy.Address] = true
+	}
+}
+
+// unindex removes a proxy from the indexes, the caller holds the write lock
+func (pm *ProxyManager) unindex(proxy ProxyInfo) {
+	removeFromIndex(pm.byType, proxy.Type, proxy.Address)
+	removeFromIndex(pm.byCountry, proxy.Country, proxy.Address)
+	for _, profile := range proxy.Profiles {
+		removeFromIndex(pm.byProfile, profile, proxy.Address)
+	}
+	delete(pm.working, proxy.Address)
+}
+
+func addToIndex[K comparable](index map[K]map[string]bool, key K, address string) {
+	if index[key] == nil {
+		index[key] = make(map[string]bool)
+	}
+	index[key][address] = true
+}
+
+func removeFromIndex[K comparable](index map[K]map[string]bool, key K, address string) {
+	delete(index[key], address)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// collect returns copies of the proxies in addresses that match keep, in
+// insertion order. The caller holds the read lock.
+func (pm *ProxyManager) collect(addresses map[string]bool, keep func(*ProxyInfo) bool) []ProxyInfo {
+	entries := make([]*managedProxy, 0, len(addresses))
+	for address := range addresses {
+		entry := pm.proxies[address]
+		if keep == nil || keep(&entry.info) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+
+	proxies := make([]ProxyInfo, len(entries))
+	for i, entry := range entries {
+		proxies[i] = entry.info
+	}
+	return proxies
+}
+
+// all returns the set of every stored address, the caller holds the read
+// lock
+func (pm *ProxyManager) all() map[string]bool {
+	addresses := make(map[string]bool, len(pm.proxies))
+	for address := range pm.proxies {
+		addresses[address] = true
+	}
+	return addresses
+}
+
+// cloneProxyInfo copies the slices and maps of a proxy so the copy can be
+// changed without affecting the original
+func cloneProxyInfo(proxy ProxyInfo) ProxyInfo {
+	if proxy.Profiles != nil {
+		proxy.Profiles = append([]string(nil), proxy.Profiles...)
+	}
+	if proxy.Targets != nil {
+		targets := make(map[string]TargetResult, len(proxy.Targets))
+		for name, result := range proxy.Targets {
+			targets[name] = result
+		}
+		proxy.Targets = targets
+	}
+	return proxy
+}
+
 // GetProxies returns all proxies
 func (pm *ProxyManager) GetProxies() []ProxyInfo {
-	return pm.proxies
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.collect(pm.all(), nil)
 }
 
 // GetWorkingProxies returns only working proxies
 func (pm *ProxyManager) GetWorkingProxies() []ProxyInfo {
-	var working []ProxyInfo
-	for _, proxy := range pm.proxies {
-		if proxy.IsWorking {
-			working = append(working, proxy)
-		}
-	}
-	return working
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.collect(pm.working, nil)
 }
 
 // GetProxiesByType returns proxies of a specific type
 func (pm *ProxyManager) GetProxiesByType(proxyType ProxyType) []ProxyInfo {
-	var filtered []ProxyInfo
-	for _, proxy := range pm.proxies {
-		if proxy.Type == proxyType {
-			filtered = append(filtered, proxy)
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.collect(pm.byType[proxyType], nil)
+}
+
+// GetProxiesByCountry returns proxies located in a country, given as an
+// ISO code such as "US"
+func (pm *ProxyManager) GetProxiesByCountry(country string) []ProxyInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.collect(pm.byCountry[country], nil)
+}
+
+// GetProxiesByProfile returns working proxies that passed the given profile
+func (pm *ProxyManager) GetProxiesByProfile(profile string) []ProxyInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.collect(pm.byProfile[profile], func(proxy *ProxyInfo) bool {
+		return proxy.IsWorking
+	})
+}
+
+// HasProfile reports whether the proxy passed the given profile
+func (p *ProxyInfo) HasProfile(profile string) bool {
+	for _, name := range p.Profiles {
+		if name == profile {
+			return true
 		}
 	}
-	return filtered
+	return false
+}
+
+// Reaches reports whether the proxy's last check of every target passed
+func (p *ProxyInfo) Reaches(targets ...string) bool {
+	for _, target := range targets {
+		if result, ok := p.Targets[target]; !ok || !result.IsWorking {
+			return false
+		}
+	}
+	return true
+}
+
+// GetProxiesReaching returns working proxies that reach all targets
+func (pm *ProxyManager) GetProxiesReaching(targets ...string) []ProxyInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.collect(pm.working, func(proxy *ProxyInfo) bool {
+		return proxy.Reaches(targets...)
+	})
+}
+
+// Enrich fills in country, city, ASN and organisation of every proxy and
+// its exit IP from the GeoIP databases
+func (pm *ProxyManager) Enrich(enricher *geoip.Enricher) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, entry := range pm.proxies {
+		proxy := entry.info
+
+		info := enricher.LookupString(proxy.IP)
+		proxy.Country, proxy.City, proxy.ASN, proxy.Org = info.Country, info.City, info.ASN, info.Org
+
+		if proxy.ExitIP != "" {
+			exit := enricher.LookupString(proxy.ExitIP)
+			proxy.ExitCountry, proxy.ExitASN, proxy.ExitOrg = exit.Country, exit.ASN, exit.Org
+		}
+
+		pm.store(proxy)
+	}
+}
+
+// ErrNoProxies is returned by Select and Lease when no working proxy
+// passes the filter
+var ErrNoProxies = errors.New("no working proxies")
+
+// Filter narrows the proxies Select, Lease and Query consider. Empty
+// fields match every proxy.
+type Filter struct {
+	Type ProxyType
+	// Country is an ISO code such as "US"
+	Country string
+	// Profile keeps proxies that passed the profile
+	Profile string
+	// Targets keeps proxies whose last check of every target passed
+	Targets []string
+}
+
+// matches reports whether proxy passes the filter
+func (f Filter) matches(proxy *ProxyInfo) bool {
+	switch {
+	case f.Type != "" && proxy.Type != f.Type,
+		f.Country != "" && proxy.Country != f.Country,
+		f.Profile != "" && !proxy.HasProfile(f.Profile):
+		return false
+	}
+	return proxy.Reaches(f.Targets...)
+}
+
+// indexed returns the smallest index set the filter narrows addresses to,
+// or addresses itself when no indexed field is set or none is smaller.
+// The caller holds the read lock.
+func (pm *ProxyManager) indexed(filter Filter, addresses map[string]bool) map[string]bool {
+	narrow := func(index map[string]bool) {
+		if len(index) < len(addresses) {
+			addresses = index
+		}
+	}
+	if filter.Type != "" {
+		narrow(pm.byType[filter.Type])
+	}
+	if filter.Country != "" {
+		narrow(pm.byCountry[filter.Country])
+	}
+	if filter.Profile != "" {
+		narrow(pm.byProfile[filter.Profile])
+	}
+	return addresses
+}
+
+// Query returns the proxies that pass filter, working or not, in
+// insertion order
+func (pm *ProxyManager) Query(filter Filter) []ProxyInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.collect(pm.indexed(filter, pm.all()), filter.matches)
+}
+
+// Select picks a working proxy that passes filter with strategy and
+// counts it as in flight until Release is called with its address. key is
+// passed on to the strategy, e.g. a session ID for Sticky.
+func (pm *ProxyManager) Select(strategy Strategy, key string, filter Filter) (ProxyInfo, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	entry, err := pm.selectLocked(strategy, key, filter)
+	if err != nil {
+		return ProxyInfo{}, err
+	}
+	return entry.info, nil
+}
+
+// selectLocked picks a proxy and counts it as in flight, the caller holds
+// the write lock
+func (pm *ProxyManager) selectLocked(strategy Strategy, key string, filter Filter) (*managedProxy, error) {
+	candidates := pm.collect(pm.indexed(filter, pm.working), func(proxy *ProxyInfo) bool {
+		return proxy.IsWorking && filter.matches(proxy)
+	})
+	if len(candidates) == 0 {
+		return nil, ErrNoProxies
+	}
+
+	picked := strategy.Pick(candidates, key)
+	entry, ok := pm.proxies[picked.Address]
+	if !ok {
+		return nil, fmt.Errorf("strategy picked unknown proxy %q", picked.Address)
+	}
+	entry.info.LastUsed = time.Now()
+	entry.info.InFlight++
+	return entry, nil
+}
+
+// Release marks one use of a proxy handed out by Select as finished
+func (pm *ProxyManager) Release(address string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.releaseLocked(address)
+}
+
+// releaseLocked is Release for callers holding the write lock
+func (pm *ProxyManager) releaseLocked(address string) {
+	if entry, ok := pm.proxies[address]; ok && entry.info.InFlight > 0 {
+		entry.info.InFlight--
+	}
 }
 
 // GetRandomProxy returns a random working proxy
@@ -102,16 +506,18 @@ func (pm *ProxyManager) GetRandomProxy() *ProxyInfo {
 		return nil
 	}
 
-	rand.Seed(time.Now().UnixNano())
 	return &working[rand.Intn(len(working))]
 }
 
-// GetFastestProxies returns the fastest working proxies
+// GetFastestProxies returns the best working proxies by score, the fastest
+// first among equal scores
 func (pm *ProxyManager) GetFastestProxies(count int) []ProxyInfo {
 	working := pm.GetWorkingProxies()
 
-	// Sort by latency
-	sort.Slice(working, func(i, j int) bool {
+	sort.SliceStable(working, func(i, j int) bool {
+		if working[i].Score != working[j].Score {
+			return working[i].Score > working[j].Score
+		}
 		return working[i].Latency < working[j].Latency
 	})
 
@@ -123,75 +529,43 @@ func (pm *ProxyManager) GetFastestProxies(count int) []ProxyInfo {
 
 // RemoveNonWorkingProxies removes proxies that are not working
 func (pm *ProxyManager) RemoveNonWorkingProxies() {
-	var working []ProxyInfo
-	for _, proxy := range pm.proxies {
-		if proxy.IsWorking {
-			working = append(working, proxy)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for address, entry := range pm.proxies {
+		if !entry.info.IsWorking {
+			pm.unindex(entry.info)
+			delete(pm.proxies, address)
 		}
 	}
-	pm.proxies = working
 }
 
-// GetStats returns proxy statistics
-func (pm *ProxyManager) GetStats() map[string]interface{} {
-	stats := make(map[string]interface{})
-
-	total := len(pm.proxies)
-	working := len(pm.GetWorkingProxies())
+// GetStats returns the stats of the managed proxies, with the number of
+// requests in flight and active leases
+func (pm *ProxyManager) GetStats() ProxyStats {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 
-	stats["total"] = total
-	stats["working"] = working
-	stats["success_rate"] = 0.0
-
-	if total > 0 {
-		stats["success_rate"] = float64(working) / float64(total) * 100
-	}
-
-	// Count by type
-	typeCount := make(map[ProxyType]int)
-	workingTypeCount := make(map[ProxyType]int)
-
-	for _, proxy := range pm.proxies {
-		typeCount[proxy.Type]++
-		if proxy.IsWorking {
-			workingTypeCount[proxy.Type]++
-		}
+	pm.expireLeases(time.Now())
+	proxies := make([]ProxyInfo, 0, len(pm.proxies))
+	for _, entry := range pm.proxies {
+		proxies = append(proxies, entry.info)
 	}
 
-	stats["by_type"] = typeCount
-	stats["working_by_type"] = workingTypeCount
-
+	stats := ComputeStats(proxies)
+	stats.Leases = len(pm.leases)
 	return stats
 }
 
 // PrintStats prints proxy statistics
 func (pm *ProxyManager) PrintStats() {
-	stats := pm.GetStats()
-
-	fmt.Printf("\n📊 Proxy Statistics:\n")
-	fmt.Printf("   Total proxies: %d\n", stats["total"])
-	fmt.Printf("   Working proxies: %d\n", stats["working"])
-	fmt.Printf("   Success rate: %.2f%%\n", stats["success_rate"])
-
-	fmt.Printf("\n📋 By Type:\n")
-	typeCount := stats["by_type"].(map[ProxyType]int)
-	workingTypeCount := stats["working_by_type"].(map[ProxyType]int)
-
-	for proxyType, count := range typeCount {
-		working := workingTypeCount[proxyType]
-		successRate := 0.0
-		if count > 0 {
-			successRate = float64(working) / float64(count) * 100
-		}
-		fmt.Printf("   %s: %d total, %d working (%.2f%%)\n",
-			strings.ToUpper(string(proxyType)), count, working, successRate)
-	}
+	pm.GetStats().WriteText(os.Stdout, "Proxy Statistics")
 }
 
 // ExportAddresses exports proxy addresses as string slice
 func (pm *ProxyManager) ExportAddresses() []string {
 	var addresses []string
-	for _, proxy := range pm.proxies {
+	for _, proxy := range pm.GetProxies() {
 		addresses = append(addresses, proxy.Address)
 	}
 	return addresses
@@ -208,15 +582,21 @@ func (pm *ProxyManager) ExportWorkingAddresses() []string {
 
 // Clear removes all proxies from the manager
 func (pm *ProxyManager) Clear() {
-	pm.proxies = make([]ProxyInfo, 0)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.reset()
 }
 
 // Count returns the total number of proxies
 func (pm *ProxyManager) Count() int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	return len(pm.proxies)
 }
 
 // WorkingCount returns the number of working proxies
 func (pm *ProxyManager) WorkingCount() int {
-	return len(pm.GetWorkingProxies())
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return len(pm.working)
 }
@@ -0,0 +1,182 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// addressesOf joins the addresses of proxies in the order they are listed
+func addressesOf(proxies []ProxyInfo) string {
+	list := make([]string, len(proxies))
+	for i, proxy := range proxies {
+		list[i] = proxy.Address
+	}
+	return strings.Join(list, " ")
+}
+
+// checkIndexes fails the test unless every index lists exactly the stored
+// proxies it should, in insertion order
+func checkIndexes(t *testing.T, pm *ProxyManager) {
+	t.Helper()
+	all := pm.GetProxies()
+
+	filter := func(keep func(ProxyInfo) bool) string {
+		var kept []ProxyInfo
+		for _, proxy := range all {
+			if keep(proxy) {
+				kept = append(kept, proxy)
+			}
+		}
+		return addressesOf(kept)
+	}
+
+	for _, proxyType := range []ProxyType{HTTP, HTTPS, SOCKS4, SOCKS5} {
+		want := filter(func(p ProxyInfo) bool { return p.Type == proxyType })
+		if got := addressesOf(pm.GetProxiesByType(proxyType)); got != want {
+			t.Errorf("type %s: %q, want %q", proxyType, got, want)
+		}
+	}
+	for _, country := range []string{"US", "DE", "JP"} {
+		want := filter(func(p ProxyInfo) bool { return p.Country == country })
+		if got := addressesOf(pm.GetProxiesByCountry(country)); got != want {
+			t.Errorf("country %s: %q, want %q", country, got, want)
+		}
+	}
+	for _, profile := range []string{"tts", "web"} {
+		want := filter(func(p ProxyInfo) bool { return p.IsWorking && p.HasProfile(profile) })
+		if got := addressesOf(pm.GetProxiesByProfile(profile)); got != want {
+			t.Errorf("profile %s: %q, want %q", profile, got, want)
+		}
+	}
+
+	working := filter(func(p ProxyInfo) bool { return p.IsWorking })
+	if got := addressesOf(pm.GetWorkingProxies()); got != working {
+		t.Errorf("working: %q, want %q", got, working)
+	}
+	if pm.Count() != len(all) || pm.WorkingCount() != len(pm.GetWorkingProxies()) {
+		t.Errorf("counts %d/%d for %d proxies", pm.Count(), pm.WorkingCount(), len(all))
+	}
+}
+
+func TestManagerIndexes(t *testing.T) {
+	pm := NewProxyManager()
+	for _, proxy := range []ProxyInfo{
+		{Address: "10.0.0.1:8080", Type: HTTP, Country: "US", IsWorking: true, Profiles: []string{"tts"}},
+		{Address: "10.0.0.2:1080", Type: SOCKS5, Country: "DE", IsWorking: true, Profiles: []string{"tts", "web"}},
+		{Address: "10.0.0.3:1080", Type: SOCKS4, Country: "US"},
+	} {
+		if err := pm.Upsert(proxy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkIndexes(t, pm)
+
+	// Changing the indexed fields moves the proxy between indexes
+	pm.Upsert(ProxyInfo{Address: "10.0.0.1:8080", Type: SOCKS5, Country: "JP", IsWorking: true, Profiles: []string{"web"}})
+	checkIndexes(t, pm)
+	if got := addressesOf(pm.GetProxiesByType(HTTP)); got != "" {
+		t.Errorf("HTTP index still lists %q", got)
+	}
+
+	pm.Update("10.0.0.2:1080", func(proxy *ProxyInfo) {
+		proxy.IsWorking = false
+		proxy.Country = ""
+	})
+	checkIndexes(t, pm)
+
+	if !pm.Remove("10.0.0.3:1080") || pm.Remove("10.0.0.3:1080") {
+		t.Error("Remove did not report the proxy once")
+	}
+	checkIndexes(t, pm)
+	if _, ok := pm.Get("10.0.0.3:1080"); ok {
+		t.Error("removed proxy still stored")
+	}
+
+	pm.Clear()
+	checkIndexes(t, pm)
+}
+
+func TestManagerUpsertKeepsPosition(t *testing.T) {
+	pm := NewProxyManager()
+	for i := 1; i <= 3; i++ {
+		pm.Upsert(ProxyInfo{Address: fmt.Sprintf("10.0.0.%d:8080", i), Type: HTTP})
+	}
+	pm.Upsert(ProxyInfo{Address: "10.0.0.1:8080", Type: HTTP, IsWorking: true})
+
+	if got := addressesOf(pm.GetProxies()); got != "10.0.0.1:8080 10.0.0.2:8080 10.0.0.3:8080" {
+		t.Errorf("order after upsert: %s", got)
+	}
+
+	proxy, _ := pm.Get("10.0.0.1:8080")
+	if proxy.IP != "10.0.0.1" || proxy.Port != "8080" {
+		t.Errorf("IP and port %q %q not filled in", proxy.IP, proxy.Port)
+	}
+}
+
+func TestManagerAddProxyIgnoresDuplicates(t *testing.T) {
+	pm := NewProxyManager()
+	pm.AddProxies([]string{"10.0.0.1:8080", "10.0.0.1:8080", "not-an-address"}, SOCKS5)
+	pm.AddProxy("10.0.0.1:8080", HTTP)
+
+	if pm.Count() != 1 {
+		t.Fatalf("%d proxies stored", pm.Count())
+	}
+	if proxy, _ := pm.Get("10.0.0.1:8080"); proxy.Type != SOCKS5 {
+		t.Errorf("type %s, AddProxy replaced the existing entry", proxy.Type)
+	}
+}
+
+func TestManagerUpsertRejectsBadAddress(t *testing.T) {
+	pm := NewProxyManager()
+	if err := pm.Upsert(ProxyInfo{Address: "10.0.0.1"}); err == nil {
+		t.Fatal("Upsert accepted an address without port")
+	}
+	if pm.Update("10.0.0.1:8080", func(*ProxyInfo) {}) {
+		t.Fatal("Update reported an unknown address")
+	}
+}
+
+func TestManagerCopiesAreIndependent(t *testing.T) {
+	pm := NewProxyManager()
+	profiles := []string{"tts"}
+	pm.Upsert(ProxyInfo{Address: "10.0.0.1:8080", IsWorking: true, Profiles: profiles})
+
+	// Changing the caller's slice does not reach the stored proxy
+	profiles[0] = "web"
+	if got := addressesOf(pm.GetProxiesByProfile("tts")); got != "10.0.0.1:8080" {
+		t.Errorf("profile index: %q", got)
+	}
+	if proxy, _ := pm.Get("10.0.0.1:8080"); proxy.Profiles[0] != "tts" {
+		t.Errorf("stored profiles %v", proxy.Profiles)
+	}
+}
+
+func TestManagerConcurrentUse(t *testing.T) {
+	pm := NewProxyManager()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				address := fmt.Sprintf("10.0.%d.%d:8080", w, i%20)
+				pm.Upsert(ProxyInfo{Address: address, Type: HTTP, IsWorking: i%2 == 0, Country: "US"})
+				if i%7 == 0 {
+					pm.Remove(address)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				pm.GetWorkingProxies()
+				pm.GetProxiesByCountry("US")
+				pm.WorkingCount()
+			}
+		}()
+	}
+	wg.Wait()
+	checkIndexes(t, pm)
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+)
+
+// RunPool runs work on every item using a fixed number of workers that read
+// from a feed channel. Only the workers and a results buffer of the same
+// size exist at any time, so memory and goroutine count stay bounded by
+// workers no matter how many items are passed in.
+//
+// collect is called on the calling goroutine for each result as soon as it
+// is ready, so it needs no locking. Items that have not been handed to a
+// worker when ctx is done are skipped.
+func RunPool[T, R any](ctx context.Context, items []T, workers int, work func(context.Context, T) R, collect func(R)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+	if workers == 0 {
+		return
+	}
+
+	feed := make(chan T)
+	results := make(chan R, workers)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range feed {
+				results <- work(ctx, item)
+			}
+		}()
+	}
+
+	// Feed items until done or canceled
+	go func() {
+		defer close(feed)
+		for _, item := range items {
+			select {
+			case feed <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Close results channel when all workers are done
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		collect(result)
+	}
+}
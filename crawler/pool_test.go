@@ -0,0 +1,176 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	benchItems   = 100000
+	benchWorkers = 200
+)
+
+// benchAddresses returns n proxy addresses
+func benchAddresses(n int) []string {
+	addresses := make([]string, n)
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("10.%d.%d.%d:8080", i>>16&0xff, i>>8&0xff, i&0xff)
+	}
+	return addresses
+}
+
+// peakGoroutines records the highest goroutine count seen by work
+type peakGoroutines struct {
+	peak atomic.Int64
+}
+
+func (p *peakGoroutines) observe() {
+	n := int64(runtime.NumGoroutine())
+	for {
+		current := p.peak.Load()
+		if n <= current || p.peak.CompareAndSwap(current, n) {
+			return
+		}
+	}
+}
+
+func TestRunPoolCollectsEveryItem(t *testing.T) {
+	items := benchAddresses(1000)
+
+	seen := make(map[string]bool, len(items))
+	RunPool(context.Background(), items, 16, func(_ context.Context, item string) string {
+		return item
+	}, func(item string) {
+		seen[item] = true
+	})
+
+	if len(seen) != len(items) {
+		t.Fatalf("collected %d of %d items", len(seen), len(items))
+	}
+}
+
+func TestRunPoolBoundsGoroutines(t *testing.T) {
+	const workers = 8
+	base := runtime.NumGoroutine()
+
+	var peak peakGoroutines
+	RunPool(context.Background(), benchAddresses(5000), workers, func(_ context.Context, item string) string {
+		peak.observe()
+		return item
+	}, func(string) {})
+
+	// Workers plus the feeder and the goroutine closing the results
+	if extra := int(peak.peak.Load()) - base; extra > workers+2 {
+		t.Fatalf("peak of %d extra goroutines with %d workers", extra, workers)
+	}
+}
+
+func TestRunPoolStopsFeedingWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var worked atomic.Int64
+	collected := 0
+	RunPool(ctx, benchAddresses(10000), 4, func(_ context.Context, item string) string {
+		worked.Add(1)
+		return item
+	}, func(string) {
+		collected++
+		if collected == 100 {
+			cancel()
+		}
+	})
+
+	if n := worked.Load(); n >= 10000 {
+		t.Fatalf("all %d items were worked on after cancel", n)
+	}
+}
+
+func TestRunPoolNoItems(t *testing.T) {
+	RunPool(context.Background(), []string(nil), 4, func(context.Context, string) string {
+		t.Fatal("work called without items")
+		return ""
+	}, func(string) {
+		t.Fatal("collect called without items")
+	})
+}
+
+// BenchmarkRunPool100k tests 100k items with a fixed pool of workers
+func BenchmarkRunPool100k(b *testing.B) {
+	items := benchAddresses(benchItems)
+	work := func(_ context.Context, item string) CheckResult {
+		return CheckResult{Proxy: item}
+	}
+	b.ReportAllocs()
+
+	var peak peakGoroutines
+	base := runtime.NumGoroutine()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		RunPool(context.Background(), items, benchWorkers, func(ctx context.Context, item string) CheckResult {
+			if item == items[len(items)/2] {
+				peak.observe()
+			}
+			return work(ctx, item)
+		}, func(CheckResult) {})
+	}
+	b.StopTimer()
+
+	extra := int(peak.peak.Load()) - base
+	b.ReportMetric(float64(extra), "goroutines")
+	if extra > benchWorkers+2 {
+		b.Fatalf("peak of %d extra goroutines with %d workers", extra, benchWorkers)
+	}
+}
+
+// BenchmarkGoroutinePerItem100k is the baseline RunPool replaced: one
+// goroutine per item, limited by a semaphore, with a results channel as
+// large as the input
+func BenchmarkGoroutinePerItem100k(b *testing.B) {
+	items := benchAddresses(benchItems)
+	work := func(_ context.Context, item string) CheckResult {
+		return CheckResult{Proxy: item}
+	}
+	b.ReportAllocs()
+
+	var peak peakGoroutines
+	base := runtime.NumGoroutine()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx := context.Background()
+		results := make(chan CheckResult, len(items))
+		semaphore := make(chan struct{}, benchWorkers)
+		var wg sync.WaitGroup
+
+		for _, item := range items {
+			wg.Add(1)
+			go func(item string) {
+				defer wg.Done()
+				select {
+				case semaphore <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-semaphore }()
+				if item == items[len(items)/2] {
+					peak.observe()
+				}
+				results <- work(ctx, item)
+			}(item)
+		}
+
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		for range results {
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(int(peak.peak.Load())-base), "goroutines")
+}
@@ -0,0 +1,185 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Prefilter quickly discards proxies whose port does not accept a TCP
+// connection or does not answer a minimal protocol handshake. It is meant
+// to run with a short timeout and high concurrency before the expensive
+// target checks.
+type Prefilter struct {
+	timeout    time.Duration
+	maxWorkers int
+	protocol   ProxyType
+	target     string
+}
+
+// NewPrefilter creates a new prefilter for HTTP proxies
+func NewPrefilter() *Prefilter {
+	return &Prefilter{
+		timeout:    3 * time.Second,
+		maxWorkers: 500,
+		protocol:   HTTP,
+		target:     "api.elevenlabs.io:443",
+	}
+}
+
+// SetTimeout sets the timeout for the connection and handshake
+func (p *Prefilter) SetTimeout(timeout time.Duration) {
+	p.timeout = timeout
+}
+
+// SetMaxWorkers sets the maximum number of concurrent workers
+func (p *Prefilter) SetMaxWorkers(workers int) {
+	p.maxWorkers = workers
+}
+
+// SetProtocol sets the proxy protocol used for the handshake of proxies
+// without a protocol set by WithProxyTypes
+func (p *Prefilter) SetProtocol(protocol ProxyType) {
+	p.protocol = protocol
+}
+
+// SetTarget sets the host:port the handshake asks the proxy to reach
+func (p *Prefilter) SetTarget(target string) {
+	p.target = target
+}
+
+// Check connects to a single proxy and performs the handshake
+func (p *Prefilter) Check(ctx context.Context, proxy string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{Timeout: p.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", proxy)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Each proxy is probed for the protocol it was listed under
+	protocol := ProxyTypeOf(ctx, proxy)
+	if protocol == "" {
+		protocol = p.protocol
+	}
+
+	switch protocol {
+	case SOCKS5:
+		return p.socks5Handshake(conn)
+	case SOCKS4:
+		return socks4Connect(conn, p.target)
+	default:
+		return p.httpHandshake(conn)
+	}
+}
+
+// httpHandshake sends a CONNECT request and expects any HTTP response other
+// than 407. Proxies that refuse CONNECT may still forward plain HTTP.
+func (p *Prefilter) httpHandshake(conn net.Conn) error {
+	request := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", p.target, p.target)
+	if _, err := io.WriteString(conn, request); err != nil {
+		return err
+	}
+
+	// "HTTP/1.1 200" is the shortest prefix that carries the status code
+	buf := make([]byte, 12)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return NewTestError(ClassProxyHandshake, fmt.Errorf("no HTTP response: %v", err))
+	}
+
+	if !bytes.HasPrefix(buf, []byte("HTTP/1.")) {
+		return NewTestError(ClassProxyHandshake, fmt.Errorf("not an HTTP proxy"))
+	}
+
+	if string(buf[9:12]) == "407" {
+		return NewTestError(ClassProxyAuth, fmt.Errorf("proxy authentication required"))
+	}
+
+	return nil
+}
+
+// socks5Handshake offers the no-authentication method and expects the
+// proxy to accept it
+func (p *Prefilter) socks5Handshake(conn net.Conn) error {
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return NewTestError(ClassProxyHandshake, fmt.Errorf("no SOCKS5 reply: %v", err))
+	}
+
+	if reply[0] != 0x05 {
+		return NewTestError(ClassProxyHandshake, fmt.Errorf("not a SOCKS5 proxy"))
+	}
+	if reply[1] != 0x00 {
+		return NewTestError(ClassProxyAuth, fmt.Errorf("SOCKS5 proxy requires authentication"))
+	}
+
+	return nil
+}
+
+// socks4Connect sends a SOCKS4a CONNECT request for target and expects it
+// to be granted
+func socks4Connect(conn net.Conn, target string) error {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("invalid SOCKS4 target: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid SOCKS4 target port: %v", err)
+	}
+
+	// SOCKS4a: IP 0.0.0.1 signals that the host name follows the user ID
+	request := []byte{0x04, 0x01, byte(port >> 8), byte(port), 0, 0, 0, 1, 0}
+	request = append(request, host...)
+	request = append(request, 0)
+
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return NewTestError(ClassProxyHandshake, fmt.Errorf("no SOCKS4 reply: %v", err))
+	}
+
+	if reply[0] != 0x00 || reply[1] != 0x5A {
+		return NewTestError(ClassProxyHandshake, fmt.Errorf("SOCKS4 request rejected (code %d)", reply[1]))
+	}
+
+	return nil
+}
+
+// Filter checks all proxies and returns the ones that passed
+func (p *Prefilter) Filter(ctx context.Context, proxies []string) []string {
+	var survivors []string
+
+	check := func(ctx context.Context, proxy string) string {
+		if p.Check(ctx, proxy) != nil {
+			return ""
+		}
+		return proxy
+	}
+
+	RunPool(ctx, proxies, p.maxWorkers, check, func(proxy string) {
+		if proxy != "" {
+			survivors = append(survivors, proxy)
+		}
+	})
+
+	return survivors
+}
@@ -0,0 +1,231 @@
+package crawler
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// ScoreWeights sets how much each component counts towards a proxy's
+// score. Only the ratios matter, the score is normalised to 0..1.
+type ScoreWeights struct {
+	Latency    float64
+	Success    float64
+	Uptime     float64
+	Errors     float64
+	Throughput float64
+}
+
+// ScoreParams tunes the scoring model
+type ScoreParams struct {
+	Weights ScoreWeights
+	// LatencyAlpha is the EWMA smoothing factor for latency, in (0, 1].
+	// Higher values follow the latest measurement more closely.
+	LatencyAlpha float64
+	// LatencyRef is the latency that earns half the latency score
+	LatencyRef time.Duration
+	// SuccessHalfLife is how long it takes a test result to count half as
+	// much towards the success ratio
+	SuccessHalfLife time.Duration
+	// ErrorHalfLife is the same for the error history, usually shorter so
+	// a burst of recent errors weighs more than the long-term ratio
+	ErrorHalfLife time.Duration
+	// UptimeHorizon is how long a proxy must have been working without
+	// interruption to earn the full uptime score
+	UptimeHorizon time.Duration
+	// ThroughputRef is the rate in bytes per second that earns half the
+	// throughput score
+	ThroughputRef float64
+}
+
+// DefaultScoreParams returns the parameters used when none are configured
+func DefaultScoreParams() ScoreParams {
+	return ScoreParams{
+		Weights: ScoreWeights{
+			Latency: 0.4,
+			Success: 0.3,
+			Uptime:  0.1,
+			Errors:  0.2,
+		},
+		LatencyAlpha:    0.3,
+		LatencyRef:      time.Second,
+		SuccessHalfLife: 24 * time.Hour,
+		ErrorHalfLife:   time.Hour,
+		UptimeHorizon:   24 * time.Hour,
+		ThroughputRef:   1 << 20,
+	}
+}
+
+// ProxyHistory is what the scoring model remembers about a proxy between
+// tests. Counters are decayed, so old results count less than new ones.
+type ProxyHistory struct {
+	FirstSeen time.Time
+	// WorkingSince is the start of the current run of passed tests, zero
+	// while the proxy is failing
+	WorkingSince time.Time
+	LastTested   time.Time
+	// LatencyEWMA is the smoothed latency of passed tests
+	LatencyEWMA time.Duration
+	// ThroughputEWMA is the smoothed download rate in bytes per second,
+	// zero until the throughput test succeeded once
+	ThroughputEWMA float64
+	// Successes and Attempts decay with SuccessHalfLife
+	Successes float64
+	Attempts  float64
+	// RecentErrors decays with ErrorHalfLife
+	RecentErrors   float64
+	LastErrorClass ErrorClass
+}
+
+// SuccessRatio returns the decayed share of passed tests, zero before the
+// first test
+func (h ProxyHistory) SuccessRatio() float64 {
+	if h.Attempts == 0 {
+		return 0
+	}
+	return h.Successes / h.Attempts
+}
+
+// Scorer turns a proxy's history into a score between 0 and 1
+type Scorer struct {
+	params ScoreParams
+}
+
+// NewScorer creates a scorer. Zero fields of params take their defaults.
+func NewScorer(params ScoreParams) *Scorer {
+	defaults := DefaultScoreParams()
+	if params.Weights == (ScoreWeights{}) {
+		params.Weights = defaults.Weights
+	}
+	if params.LatencyAlpha <= 0 || params.LatencyAlpha > 1 {
+		params.LatencyAlpha = defaults.LatencyAlpha
+	}
+	if params.LatencyRef <= 0 {
+		params.LatencyRef = defaults.LatencyRef
+	}
+	if params.SuccessHalfLife <= 0 {
+		params.SuccessHalfLife = defaults.SuccessHalfLife
+	}
+	if params.ErrorHalfLife <= 0 {
+		params.ErrorHalfLife = defaults.ErrorHalfLife
+	}
+	if params.UptimeHorizon <= 0 {
+		params.UptimeHorizon = defaults.UptimeHorizon
+	}
+	if params.ThroughputRef <= 0 {
+		params.ThroughputRef = defaults.ThroughputRef
+	}
+	return &Scorer{params: params}
+}
+
+// Params returns the parameters in use, with defaults filled in
+func (s *Scorer) Params() ScoreParams {
+	return s.params
+}
+
+// Observe records a test result taken at the given time
+func (s *Scorer) Observe(h *ProxyHistory, working bool, latency time.Duration, class ErrorClass, at time.Time) {
+	if h.FirstSeen.IsZero() {
+		h.FirstSeen = at
+	}
+	s.decay(h, at)
+
+	h.Attempts++
+	if working {
+		h.Successes++
+		if h.WorkingSince.IsZero() {
+			h.WorkingSince = at
+		}
+		if h.LatencyEWMA == 0 {
+			h.LatencyEWMA = latency
+		} else {
+			alpha := s.params.LatencyAlpha
+			h.LatencyEWMA = time.Duration(alpha*float64(latency) + (1-alpha)*float64(h.LatencyEWMA))
+		}
+	} else {
+		h.RecentErrors++
+		h.WorkingSince = time.Time{}
+		h.LastErrorClass = class
+	}
+}
+
+// ObserveThroughput records a measured download rate in bytes per second.
+// It is smoothed with LatencyAlpha like the latency.
+func (s *Scorer) ObserveThroughput(h *ProxyHistory, bytesPerSecond float64) {
+	if bytesPerSecond <= 0 {
+		return
+	}
+	if h.ThroughputEWMA == 0 {
+		h.ThroughputEWMA = bytesPerSecond
+	} else {
+		alpha := s.params.LatencyAlpha
+		h.ThroughputEWMA = alpha*bytesPerSecond + (1-alpha)*h.ThroughputEWMA
+	}
+}
+
+// decay ages the counters of h to the given time
+func (s *Scorer) decay(h *ProxyHistory, at time.Time) {
+	if !h.LastTested.IsZero() && at.After(h.LastTested) {
+		elapsed := at.Sub(h.LastTested)
+		success := halfLifeFactor(elapsed, s.params.SuccessHalfLife)
+		h.Successes *= success
+		h.Attempts *= success
+		h.RecentErrors *= halfLifeFactor(elapsed, s.params.ErrorHalfLife)
+	}
+	if at.After(h.LastTested) {
+		h.LastTested = at
+	}
+}
+
+// halfLifeFactor returns how much of a value is left after elapsed
+func halfLifeFactor(elapsed, halfLife time.Duration) float64 {
+	return math.Pow(0.5, float64(elapsed)/float64(halfLife))
+}
+
+// Score returns the weighted score of h at the given time. Proxies that
+// were never tested score zero.
+func (s *Scorer) Score(h ProxyHistory, at time.Time) float64 {
+	if h.Attempts == 0 {
+		return 0
+	}
+	s.decay(&h, at)
+
+	latency := 0.0
+	if h.LatencyEWMA > 0 {
+		ref := float64(s.params.LatencyRef)
+		latency = ref / (ref + float64(h.LatencyEWMA))
+	}
+
+	uptime := 0.0
+	if !h.WorkingSince.IsZero() {
+		uptime = math.Min(float64(at.Sub(h.WorkingSince))/float64(s.params.UptimeHorizon), 1)
+	}
+
+	throughput := 0.0
+	if h.ThroughputEWMA > 0 {
+		throughput = h.ThroughputEWMA / (h.ThroughputEWMA + s.params.ThroughputRef)
+	}
+
+	// One recent error halves the error score, two leave a third
+	errors := 1 / (1 + h.RecentErrors)
+
+	w := s.params.Weights
+	total := w.Latency + w.Success + w.Uptime + w.Errors + w.Throughput
+	if total <= 0 {
+		return 0
+	}
+	return (w.Latency*latency + w.Success*h.SuccessRatio() + w.Uptime*uptime + w.Errors*errors +
+		w.Throughput*throughput) / total
+}
+
+// RankByScore sorts proxies by descending score, breaking ties by address
+// so the order is stable between cycles
+func RankByScore(proxies []string, scores map[string]float64) {
+	sort.Slice(proxies, func(i, j int) bool {
+		si, sj := scores[proxies[i]], scores[proxies[j]]
+		if si != sj {
+			return si > sj
+		}
+		return proxies[i] < proxies[j]
+	})
+}
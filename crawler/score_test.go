@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var scoreEpoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestScorerLatencyEWMA(t *testing.T) {
+	scorer := NewScorer(ScoreParams{LatencyAlpha: 0.5})
+	var h ProxyHistory
+
+	tests := []struct {
+		latency time.Duration
+		working bool
+		want    time.Duration
+	}{
+		// The first passed test sets the average
+		{100 * time.Millisecond, true, 100 * time.Millisecond},
+		{300 * time.Millisecond, true, 200 * time.Millisecond},
+		// Failed tests do not move it
+		{5 * time.Second, false, 200 * time.Millisecond},
+		{100 * time.Millisecond, true, 150 * time.Millisecond},
+	}
+	for i, tt := range tests {
+		scorer.Observe(&h, tt.working, tt.latency, ClassConnTimeout, scoreEpoch.Add(time.Duration(i)*time.Minute))
+		if h.LatencyEWMA != tt.want {
+			t.Fatalf("test %d: EWMA %v, want %v", i, h.LatencyEWMA, tt.want)
+		}
+	}
+}
+
+func TestScorerHalfLifeDecay(t *testing.T) {
+	params := DefaultScoreParams()
+	params.SuccessHalfLife = time.Hour
+	params.ErrorHalfLife = 10 * time.Minute
+	scorer := NewScorer(params)
+
+	var h ProxyHistory
+	scorer.Observe(&h, true, time.Second, ClassNone, scoreEpoch)
+	scorer.Observe(&h, false, 0, ClassDNS, scoreEpoch.Add(time.Hour))
+
+	// The success is an hour old and counts half
+	if !approx(h.Successes, 0.5) || !approx(h.Attempts, 1.5) {
+		t.Fatalf("successes %v of %v attempts, want 0.5 of 1.5", h.Successes, h.Attempts)
+	}
+	if !approx(h.SuccessRatio(), 1.0/3) {
+		t.Errorf("success ratio %v, want 1/3", h.SuccessRatio())
+	}
+	if h.LastErrorClass != ClassDNS || !h.WorkingSince.IsZero() {
+		t.Errorf("error class %q, working since %v", h.LastErrorClass, h.WorkingSince)
+	}
+
+	// Errors decay with their own, shorter half-life
+	scorer.decay(&h, scoreEpoch.Add(time.Hour+20*time.Minute))
+	if !approx(h.RecentErrors, 0.25) {
+		t.Errorf("recent errors %v after two half-lives, want 0.25", h.RecentErrors)
+	}
+}
+
+func TestScoreComponents(t *testing.T) {
+	horizon := 24 * time.Hour
+	tests := []struct {
+		name    string
+		weights ScoreWeights
+		latency time.Duration
+		at      time.Duration
+		want    float64
+	}{
+		{"latency at the reference", ScoreWeights{Latency: 1}, time.Second, 0, 0.5},
+		{"latency at a third of the reference", ScoreWeights{Latency: 1}, time.Second / 3, 0, 0.75},
+		{"uptime half the horizon", ScoreWeights{Uptime: 1}, time.Second, horizon / 2, 0.5},
+		{"uptime past the horizon", ScoreWeights{Uptime: 1}, time.Second, 2 * horizon, 1},
+		{"success only", ScoreWeights{Success: 1}, time.Second, 0, 1},
+		{"no errors", ScoreWeights{Errors: 1}, time.Second, 0, 1},
+		{"weights are normalised", ScoreWeights{Latency: 2, Success: 2}, time.Second, 0, 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scorer := NewScorer(ScoreParams{Weights: tt.weights, LatencyRef: time.Second, UptimeHorizon: horizon})
+			var h ProxyHistory
+			scorer.Observe(&h, true, tt.latency, ClassNone, scoreEpoch)
+			if got := scorer.Score(h, scoreEpoch.Add(tt.at)); !approx(got, tt.want) {
+				t.Errorf("score %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreThroughput(t *testing.T) {
+	scorer := NewScorer(ScoreParams{Weights: ScoreWeights{Throughput: 1}, LatencyAlpha: 0.5, ThroughputRef: 1000})
+	var h ProxyHistory
+	scorer.Observe(&h, true, time.Second, ClassNone, scoreEpoch)
+
+	// Not measured yet
+	if got := scorer.Score(h, scoreEpoch); got != 0 {
+		t.Fatalf("unmeasured proxy scores %v", got)
+	}
+
+	tests := []struct {
+		rate float64
+		want float64
+	}{
+		{1000, 0.5},
+		// Failed measurements are ignored
+		{0, 0.5},
+		{5000, 0.75},
+	}
+	for i, tt := range tests {
+		scorer.ObserveThroughput(&h, tt.rate)
+		if got := scorer.Score(h, scoreEpoch); !approx(got, tt.want) {
+			t.Errorf("test %d: score %v at %v B/s, want %v", i, got, h.ThroughputEWMA, tt.want)
+		}
+	}
+}
+
+func TestScoreErrors(t *testing.T) {
+	scorer := NewScorer(ScoreParams{Weights: ScoreWeights{Errors: 1}, ErrorHalfLife: time.Hour})
+	var h ProxyHistory
+
+	if got := scorer.Score(h, scoreEpoch); got != 0 {
+		t.Fatalf("untested proxy scores %v", got)
+	}
+
+	scorer.Observe(&h, false, 0, ClassConnRefused, scoreEpoch)
+	if got := scorer.Score(h, scoreEpoch); !approx(got, 0.5) {
+		t.Errorf("one recent error scores %v, want 0.5", got)
+	}
+	scorer.Observe(&h, false, 0, ClassConnRefused, scoreEpoch)
+	if got := scorer.Score(h, scoreEpoch); !approx(got, 1.0/3) {
+		t.Errorf("two recent errors score %v, want 1/3", got)
+	}
+
+	// Scoring decays a copy, the history itself is left alone
+	if got := scorer.Score(h, scoreEpoch.Add(time.Hour)); !approx(got, 0.5) {
+		t.Errorf("two errors an hour old score %v, want 0.5", got)
+	}
+	if !approx(h.RecentErrors, 2) {
+		t.Errorf("Score changed the history to %v errors", h.RecentErrors)
+	}
+}
+
+func TestNewScorerDefaults(t *testing.T) {
+	if got, want := NewScorer(ScoreParams{}).Params(), DefaultScoreParams(); got != want {
+		t.Errorf("params %+v, want %+v", got, want)
+	}
+	if got := NewScorer(ScoreParams{LatencyAlpha: 1.5}).Params().LatencyAlpha; got != DefaultScoreParams().LatencyAlpha {
+		t.Errorf("alpha above 1 kept as %v", got)
+	}
+}
+
+func TestRankByScore(t *testing.T) {
+	proxies := []string{"c:1", "b:1", "a:1", "d:1"}
+	RankByScore(proxies, map[string]float64{"a:1": 0.5, "b:1": 0.9, "c:1": 0.5})
+
+	want := []string{"b:1", "a:1", "c:1", "d:1"}
+	for i := range want {
+		if proxies[i] != want[i] {
+			t.Fatalf("ranked %v, want %v", proxies, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// StabilityThresholds are the limits a proxy must meet over all samples to
+// pass a StabilityChecker. Zero disables a limit.
+type StabilityThresholds struct {
+	MinSuccessRatio float64
+	MaxP95Latency   time.Duration
+	MaxJitter       time.Duration
+}
+
+// StabilityStats summarises repeated samples of the same check
+type StabilityStats struct {
+	Samples      int
+	Successes    int
+	SuccessRatio float64
+	MeanLatency  time.Duration
+	P95Latency   time.Duration
+	// Jitter is the standard deviation of the successful latencies
+	Jitter time.Duration
+}
+
+// StabilityChecker runs another check several times per proxy, spread over
+// a window, so that one lucky request does not get a flapping proxy kept.
+// Each proxy occupies a worker for the whole window.
+type StabilityChecker struct {
+	checker    Checker
+	samples    int
+	window     time.Duration
+	thresholds StabilityThresholds
+}
+
+// NewStabilityChecker wraps checker so that each proxy is sampled samples
+// times over window and only passes when it meets thresholds
+func NewStabilityChecker(checker Checker, samples int, window time.Duration, thresholds StabilityThresholds) *StabilityChecker {
+	if samples < 1 {
+		samples = 1
+	}
+	return &StabilityChecker{
+		checker:    checker,
+		samples:    samples,
+		window:     window,
+		thresholds: thresholds,
+	}
+}
+
+// Name returns the name of the wrapped check
+func (s *StabilityChecker) Name() string {
+	return s.checker.Name()
+}
+
+// BeginCycle forwards the cycle start to the wrapped check
+func (s *StabilityChecker) BeginCycle() {
+	if cycleChecker, ok := s.checker.(CycleChecker); ok {
+		cycleChecker.BeginCycle()
+	}
+}
+
+// TakeUsage returns the quota spent by the wrapped check
+func (s *StabilityChecker) TakeUsage() int64 {
+	if reporter, ok := s.checker.(UsageReporter); ok {
+		return reporter.TakeUsage()
+	}
+	return 0
+}
+
+// Check samples a single proxy and judges it by the thresholds. The result
+// reports the mean latency and carries the stats in Stability.
+func (s *StabilityChecker) Check(ctx context.Context, proxy string) CheckResult {
+	var interval time.Duration
+	if s.samples > 1 {
+		interval = s.window / time.Duration(s.samples-1)
+	}
+
+	var latencies []time.Duration
+	var lastFailure, lastSuccess CheckResult
+	taken := 0
+
+	for i := 0; i < s.samples; i++ {
+		if i > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := s.checker.Check(ctx, proxy)
+		taken++
+		if result.IsWorking {
+			latencies = append(latencies, result.Latency)
+			lastSuccess = result
+		} else {
+			lastFailure = result
+		}
+	}
+
+	stats := summarizeSamples(taken, latencies)
+
+	// A window cut short by shutdown or the cycle timeout says nothing
+	// about stability, so the samples taken so far are not judged
+	if ctx.Err() != nil {
+		return CheckResult{
+			Proxy:      proxy,
+			Check:      s.Name(),
+			Latency:    stats.MeanLatency,
+			Error:      ctx.Err(),
+			ErrorClass: ClassCanceled,
+			Stability:  &stats,
+		}
+	}
+
+	result := lastSuccess
+	if len(latencies) == 0 {
+		result = lastFailure
+	}
+	result.Latency = stats.MeanLatency
+	result.Stability = &stats
+
+	if len(latencies) == 0 {
+		return result
+	}
+
+	if err := s.judge(stats); err != nil {
+		result.IsWorking = false
+		result.Error = err
+		result.ErrorClass = ClassUnstable
+	}
+	return result
+}
+
+// judge returns why stats miss the thresholds, or nil if they meet them
+func (s *StabilityChecker) judge(stats StabilityStats) error {
+	t := s.thresholds
+
+	switch {
+	case stats.SuccessRatio < t.MinSuccessRatio:
+		return NewTestError(ClassUnstable, fmt.Errorf("passed %d/%d samples", stats.Successes, stats.Samples))
+	case t.MaxP95Latency > 0 && stats.P95Latency > t.MaxP95Latency:
+		return NewTestError(ClassUnstable, fmt.Errorf("p95 latency %v over %v", stats.P95Latency, t.MaxP95Latency))
+	case t.MaxJitter > 0 && stats.Jitter > t.MaxJitter:
+		return NewTestError(ClassUnstable, fmt.Errorf("jitter %v over %v", stats.Jitter, t.MaxJitter))
+	}
+	return nil
+}
+
+// summarizeSamples computes the stats of taken samples given the latencies
+// of the successful ones
+func summarizeSamples(taken int, latencies []time.Duration) StabilityStats {
+	stats := StabilityStats{
+		Samples:   taken,
+		Successes: len(latencies),
+	}
+	if taken > 0 {
+		stats.SuccessRatio = float64(len(latencies)) / float64(taken)
+	}
+	if len(latencies) == 0 {
+		return stats
+	}
+
+	var sum time.Duration
+	for _, latency := range latencies {
+		sum += latency
+	}
+	mean := sum / time.Duration(len(latencies))
+	stats.MeanLatency = mean
+
+	var variance float64
+	for _, latency := range latencies {
+		diff := float64(latency - mean)
+		variance += diff * diff
+	}
+	stats.Jitter = time.Duration(math.Sqrt(variance / float64(len(latencies))))
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.P95Latency = Percentile(sorted, 95)
+
+	return stats
+}
+
+// Percentile returns the p-th percentile of sorted using the nearest-rank
+// method. sorted must be in ascending order.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sample is one scripted result of scriptedChecker, a zero latency fails
+type sample time.Duration
+
+// scriptedChecker returns the scripted samples in turn and calls onCheck
+// after each of them
+type scriptedChecker struct {
+	mu      sync.Mutex
+	samples []sample
+	calls   int
+	onCheck func(calls int)
+}
+
+func (c *scriptedChecker) Name() string {
+	return "scripted"
+}
+
+func (c *scriptedChecker) Check(ctx context.Context, proxy string) CheckResult {
+	c.mu.Lock()
+	s := c.samples[c.calls%len(c.samples)]
+	c.calls++
+	calls := c.calls
+	c.mu.Unlock()
+
+	result := CheckResult{Proxy: proxy, Check: c.Name(), IsWorking: s > 0, Latency: time.Duration(s)}
+	if s == 0 {
+		result.Error = errors.New("refused")
+		result.ErrorClass = ClassConnRefused
+	}
+	if c.onCheck != nil {
+		c.onCheck(calls)
+	}
+	return result
+}
+
+func ms(n int) sample {
+	return sample(time.Duration(n) * time.Millisecond)
+}
+
+func TestSummarizeSamples(t *testing.T) {
+	tests := []struct {
+		name      string
+		taken     int
+		latencies []time.Duration
+		want      StabilityStats
+	}{
+		{"nothing taken", 0, nil, StabilityStats{}},
+		{"all failed", 3, nil, StabilityStats{Samples: 3}},
+		{"one success", 1, []time.Duration{120 * time.Millisecond},
+			StabilityStats{Samples: 1, Successes: 1, SuccessRatio: 1, MeanLatency: 120 * time.Millisecond, P95Latency: 120 * time.Millisecond}},
+		{"unsorted with a failure", 5, []time.Duration{300 * time.Millisecond, 100 * time.Millisecond, 300 * time.Millisecond, 100 * time.Millisecond},
+			StabilityStats{Samples: 5, Successes: 4, SuccessRatio: 0.8, MeanLatency: 200 * time.Millisecond,
+				P95Latency: 300 * time.Millisecond, Jitter: 100 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeSamples(tt.taken, tt.latencies); got != tt.want {
+				t.Errorf("stats %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 20)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 10 * time.Millisecond},
+		{95, 19 * time.Millisecond},
+		{100, 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := Percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("p%v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if got := Percentile(nil, 95); got != 0 {
+		t.Errorf("p95 of nothing = %v", got)
+	}
+}
+
+func TestStabilityJudgement(t *testing.T) {
+	thresholds := StabilityThresholds{
+		MinSuccessRatio: 0.75,
+		MaxP95Latency:   500 * time.Millisecond,
+		MaxJitter:       100 * time.Millisecond,
+	}
+	tests := []struct {
+		name    string
+		samples []sample
+		working bool
+		class   ErrorClass
+	}{
+		{"steady", []sample{ms(100), ms(120), ms(110), ms(130)}, true, ClassNone},
+		{"one failure is tolerated", []sample{ms(100), 0, ms(110), ms(130)}, true, ClassNone},
+		{"too many failures", []sample{ms(100), 0, 0, ms(130)}, false, ClassUnstable},
+		{"slow p95", []sample{ms(400), ms(450), ms(480), ms(520)}, false, ClassUnstable},
+		{"jittery", []sample{ms(50), ms(350), ms(50), ms(350)}, false, ClassUnstable},
+		// Without a single success the failure itself is reported
+		{"never works", []sample{0}, false, ClassConnRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewStabilityChecker(&scriptedChecker{samples: tt.samples}, 4, 0, thresholds)
+			result := checker.Check(context.Background(), "10.0.0.1:8080")
+			if result.IsWorking != tt.working || result.ErrorClass != tt.class {
+				t.Errorf("working %v with class %q (%v), want %v with %q",
+					result.IsWorking, result.ErrorClass, result.Error, tt.working, tt.class)
+			}
+			if result.Stability == nil || result.Stability.Samples != 4 {
+				t.Fatalf("stats %+v, want 4 samples", result.Stability)
+			}
+			if result.Latency != result.Stability.MeanLatency {
+				t.Errorf("latency %v, want the mean %v", result.Latency, result.Stability.MeanLatency)
+			}
+		})
+	}
+}
+
+func TestStabilityCanceledWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   time.Duration
+		cancelAt int
+		taken    int
+	}{
+		{"before the first sample", time.Hour, 0, 0},
+		{"while waiting for the next sample", time.Hour, 1, 1},
+		// The last sample may have been cut short itself
+		{"during the last sample", 0, 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelAt == 0 {
+				cancel()
+			}
+
+			// Samples that all pass would keep the proxy if judged
+			inner := &scriptedChecker{samples: []sample{ms(100)}, onCheck: func(calls int) {
+				if calls == tt.cancelAt {
+					cancel()
+				}
+			}}
+			checker := NewStabilityChecker(inner, 5, tt.window, StabilityThresholds{MinSuccessRatio: 0.5})
+
+			done := make(chan CheckResult)
+			go func() { done <- checker.Check(ctx, "10.0.0.1:8080") }()
+			var result CheckResult
+			select {
+			case result = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Check kept waiting after the context was canceled")
+			}
+
+			if result.IsWorking || result.ErrorClass != ClassCanceled || !errors.Is(result.Error, context.Canceled) {
+				t.Errorf("working %v with class %q (%v), want canceled", result.IsWorking, result.ErrorClass, result.Error)
+			}
+			if result.Stability == nil || result.Stability.Samples != tt.taken {
+				t.Errorf("stats %+v, want %d samples", result.Stability, tt.taken)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram in
+// milliseconds. Latencies above the last bound go to an overflow bucket.
+var LatencyBuckets = []float64{100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Unknown is the breakdown key of proxies without a type, country or source
+const Unknown = "unknown"
+
+// HistogramBucket counts latencies above the previous bucket's bound up to
+// UpperMs. The overflow bucket has an UpperMs of zero.
+type HistogramBucket struct {
+	UpperMs float64 `json:"upper_ms"`
+	Count   int     `json:"count"`
+}
+
+// LatencySummary describes a latency distribution
+type LatencySummary struct {
+	Count   int               `json:"count"`
+	MeanMs  float64           `json:"mean_ms"`
+	P50Ms   float64           `json:"p50_ms"`
+	P90Ms   float64           `json:"p90_ms"`
+	P99Ms   float64           `json:"p99_ms"`
+	MaxMs   float64           `json:"max_ms"`
+	Buckets []HistogramBucket `json:"buckets,omitempty"`
+}
+
+// NewLatencySummary summarises latencies. Percentiles use the nearest
+// rank, so they are always one of the measured values.
+func NewLatencySummary(latencies []time.Duration) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	buckets := make([]HistogramBucket, len(LatencyBuckets)+1)
+	for i, upper := range LatencyBuckets {
+		buckets[i].UpperMs = upper
+	}
+
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+		ms := milliseconds(latency)
+		i := sort.SearchFloat64s(LatencyBuckets, ms)
+		buckets[i].Count++
+	}
+
+	return LatencySummary{
+		Count:   len(sorted),
+		MeanMs:  milliseconds(total) / float64(len(sorted)),
+		P50Ms:   milliseconds(Percentile(sorted, 50)),
+		P90Ms:   milliseconds(Percentile(sorted, 90)),
+		P99Ms:   milliseconds(Percentile(sorted, 99)),
+		MaxMs:   milliseconds(sorted[len(sorted)-1]),
+		Buckets: buckets,
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Breakdown is the share of proxies in one group that work, and how fast
+// the working ones are
+type Breakdown struct {
+	Total   int            `json:"total"`
+	Working int            `json:"working"`
+	Latency LatencySummary `json:"latency"`
+}
+
+// SuccessRate returns the working share of the group in percent
+func (b Breakdown) SuccessRate() float64 {
+	if b.Total == 0 {
+		return 0
+	}
+	return float64(b.Working) / float64(b.Total) * 100
+}
+
+// ProxyStats describes a set of proxies. The logs, the CLI and the daemon
+// stats all render from it.
+type ProxyStats struct {
+	Total       int            `json:"total"`
+	Working     int            `json:"working"`
+	SuccessRate float64        `json:"success_rate"`
+	Latency     LatencySummary `json:"latency"`
+	// Breakdowns by proxy type, entry country and the source the proxy was
+	// crawled from. Proxies without a type, country or source count as
+	// Unknown.
+	ByType    map[string]Breakdown `json:"by_type"`
+	ByCountry map[string]Breakdown `json:"by_country"`
+	BySource  map[string]Breakdown `json:"by_source"`
+	// ByErrorClass counts the failed proxies by the class of their error
+	ByErrorClass map[string]int `json:"by_error_class"`
+	// InFlight and Leases are only filled in by ProxyManager
+	InFlight int `json:"in_flight"`
+	Leases   int `json:"leases"`
+}
+
+// ComputeStats computes the stats of proxies. Latency only counts working
+// proxies.
+func ComputeStats(proxies []ProxyInfo) ProxyStats {
+	stats := ProxyStats{
+		Total:        len(proxies),
+		ByErrorClass: make(map[string]int),
+	}
+
+	var latencies []time.Duration
+	byType := newBreakdownBuilder()
+	byCountry := newBreakdownBuilder()
+	bySource := newBreakdownBuilder()
+
+	for _, proxy := range proxies {
+		byType.add(orUnknown(string(proxy.Type)), proxy)
+		byCountry.add(orUnknown(proxy.Country), proxy)
+		bySource.add(orUnknown(proxy.Source), proxy)
+
+		if proxy.IsWorking {
+			stats.Working++
+			if proxy.Latency > 0 {
+				latencies = append(latencies, proxy.Latency)
+			}
+		} else if proxy.ErrorClass != "" {
+			stats.ByErrorClass[string(proxy.ErrorClass)]++
+		}
+		stats.InFlight += proxy.InFlight
+	}
+
+	if stats.Total > 0 {
+		stats.SuccessRate = float64(stats.Working) / float64(stats.Total) * 100
+	}
+	stats.Latency = NewLatencySummary(latencies)
+	stats.ByType = byType.build()
+	stats.ByCountry = byCountry.build()
+	stats.BySource = bySource.build()
+	return stats
+}
+
+// breakdownBuilder collects the proxies of each group of a breakdown
+type breakdownBuilder struct {
+	breakdowns map[string]Breakdown
+	latencies  map[string][]time.Duration
+}
+
+func newBreakdownBuilder() *breakdownBuilder {
+	return &breakdownBuilder{
+		breakdowns: make(map[string]Breakdown),
+		latencies:  make(map[string][]time.Duration),
+	}
+}
+
+func (b *breakdownBuilder) add(key string, proxy ProxyInfo) {
+	breakdown := b.breakdowns[key]
+	breakdown.Total++
+	if proxy.IsWorking {
+		breakdown.Working++
+		if proxy.Latency > 0 {
+			b.latencies[key] = append(b.latencies[key], proxy.Latency)
+		}
+	}
+	b.breakdowns[key] = breakdown
+}
+
+func (b *breakdownBuilder) build() map[string]Breakdown {
+	for key, latencies := range b.latencies {
+		breakdown := b.breakdowns[key]
+		breakdown.Latency = NewLatencySummary(latencies)
+		b.breakdowns[key] = breakdown
+	}
+	return b.breakdowns
+}
+
+func orUnknown(key string) string {
+	if key == "" {
+		return Unknown
+	}
+	return key
+}
+
+// InfoFromResult returns the ProxyInfo of a check result, for computing
+// stats over a test run. The type is the one the result was tested with,
+// empty when it is not known.
+func InfoFromResult(result CheckResult) ProxyInfo {
+	ip, port, _ := strings.Cut(result.Proxy, ":")
+	return ProxyInfo{
+		Address:    result.Proxy,
+		IP:         ip,
+		Port:       port,
+		Type:       result.Type,
+		Latency:    result.Latency,
+		IsWorking:  result.IsWorking,
+		ErrorClass: result.ErrorClass,
+		ExitIP:     result.ExitIP,
+	}
+}
+
+// String returns a one-line summary for the logs
+func (s ProxyStats) String() string {
+	summary := fmt.Sprintf("working %d/%d (%.2f%%)", s.Working, s.Total, s.SuccessRate)
+	if s.Latency.Count > 0 {
+		summary += fmt.Sprintf(", latency p50 %s p90 %s p99 %s",
+			formatMs(s.Latency.P50Ms), formatMs(s.Latency.P90Ms), formatMs(s.Latency.P99Ms))
+	}
+	return summary
+}
+
+// WriteText writes the stats as a human-readable report under title
+func (s ProxyStats) WriteText(w io.Writer, title string) {
+	fmt.Fprintf(w, "\n📊 %s:\n", title)
+	fmt.Fprintf(w, "   Total proxies: %d\n", s.Total)
+	fmt.Fprintf(w, "   Working proxies: %d\n", s.Working)
+	fmt.Fprintf(w, "   Success rate: %.2f%%\n", s.SuccessRate)
+	if s.InFlight > 0 || s.Leases > 0 {
+		fmt.Fprintf(w, "   In flight: %d, leases: %d\n", s.InFlight, s.Leases)
+	}
+
+	if s.Latency.Count > 0 {
+		l := s.Latency
+		fmt.Fprintf(w, "\n⏱️  Latency (%d working):\n", l.Count)
+		fmt.Fprintf(w, "   mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+			formatMs(l.MeanMs), formatMs(l.P50Ms), formatMs(l.P90Ms), formatMs(l.P99Ms), formatMs(l.MaxMs))
+		for _, bucket := range l.Buckets {
+			label := "> " + formatMs(LatencyBuckets[len(LatencyBuckets)-1])
+			if bucket.UpperMs > 0 {
+				label = "≤ " + formatMs(bucket.UpperMs)
+			}
+			fmt.Fprintf(w, "   %-8s %6d %s\n", label, bucket.Count, bar(bucket.Count, l.Count))
+		}
+	}
+
+	writeBreakdowns(w, "By Type", s.ByType, strings.ToUpper)
+	writeBreakdowns(w, "By Country", s.ByCountry, nil)
+	writeBreakdowns(w, "By Source", s.BySource, nil)
+
+	if len(s.ByErrorClass) > 0 {
+		counts := make(ErrorClassCounts, len(s.ByErrorClass))
+		for class, count := range s.ByErrorClass {
+			counts[ErrorClass(class)] = count
+		}
+		fmt.Fprintf(w, "\n❌ Failures by class: %s\n", counts)
+	}
+}
+
+// writeBreakdowns writes one breakdown, largest groups first
+func writeBreakdowns(w io.Writer, title string, breakdowns map[string]Breakdown, label func(string) string) {
+	if len(breakdowns) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(breakdowns))
+	for key := range breakdowns {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		bi, bj := breakdowns[keys[i]], breakdowns[keys[j]]
+		if bi.Total != bj.Total {
+			return bi.Total > bj.Total
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(w, "\n📋 %s:\n", title)
+	for _, key := range keys {
+		b := breakdowns[key]
+		name := key
+		if label != nil {
+			name = label(key)
+		}
+		line := fmt.Sprintf("   %s: %d total, %d working (%.2f%%)", name, b.Total, b.Working, b.SuccessRate())
+		if b.Latency.Count > 0 {
+			line += fmt.Sprintf(", p50 %s", formatMs(b.Latency.P50Ms))
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// formatMs formats milliseconds like a rounded time.Duration
+func formatMs(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+}
+
+// bar draws count as a share of total, 30 characters wide
+func bar(count, total int) string {
+	if total == 0 {
+		return ""
+	}
+	return strings.Repeat("█", int(math.Round(float64(count)/float64(total)*30)))
+}
@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatsByTestedType(t *testing.T) {
+	ctx := WithProxyTypes(context.Background(), map[string]ProxyType{
+		"10.0.0.1:1080": SOCKS5,
+		"10.0.0.2:1080": SOCKS5,
+		"10.0.0.3:8080": HTTP,
+	})
+	proxies := []string{"10.0.0.1:1080", "10.0.0.2:1080", "10.0.0.3:8080", "10.0.0.4:3128"}
+
+	checker := &scriptedChecker{samples: []sample{sample(100 * time.Millisecond)}}
+	results, err := NewRunner(2).Run(ctx, checker, proxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos := make([]ProxyInfo, len(results))
+	for i, result := range results {
+		infos[i] = InfoFromResult(result)
+	}
+	stats := ComputeStats(infos)
+
+	// A proxy the caller gave no type is not assumed to be HTTP
+	want := map[string]int{"socks5": 2, "http": 1, Unknown: 1}
+	if len(stats.ByType) != len(want) {
+		t.Fatalf("types %v, want %v", stats.ByType, want)
+	}
+	for proxyType, total := range want {
+		if got := stats.ByType[proxyType].Total; got != total {
+			t.Errorf("%s: %d proxies, want %d", proxyType, got, total)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package crawler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Strategy picks the proxy a consumer should use next. Pick is given the
+// working proxies in insertion order, never an empty slice, and key
+// identifies the consumer's session for strategies that care about it.
+type Strategy interface {
+	Pick(candidates []ProxyInfo, key string) ProxyInfo
+}
+
+// Strategy names accepted by NewStrategy
+const (
+	StrategyRoundRobin    = "round_robin"
+	StrategyWeighted      = "weighted"
+	StrategyLRU           = "lru"
+	StrategyLeastInFlight = "least_in_flight"
+	StrategySticky        = "sticky"
+)
+
+// StrategyNames lists the names accepted by NewStrategy
+var StrategyNames = []string{
+	StrategyRoundRobin,
+	StrategyWeighted,
+	StrategyLRU,
+	StrategyLeastInFlight,
+	StrategySticky,
+}
+
+// NewStrategy creates a strategy by name. Weighted random draws from a
+// source seeded with the current time.
+func NewStrategy(name string) (Strategy, error) {
+	switch name {
+	case StrategyRoundRobin:
+		return NewRoundRobin(), nil
+	case StrategyWeighted:
+		return NewWeightedRandom(rand.NewSource(time.Now().UnixNano()), nil), nil
+	case StrategyLRU:
+		return LeastRecentlyUsed{}, nil
+	case StrategyLeastInFlight:
+		return LeastInFlight{}, nil
+	case StrategySticky:
+		return NewSticky(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+}
+
+// RoundRobin hands out the candidates in turn
+type RoundRobin struct {
+	mu   sync.Mutex
+	next int
+}
+
+// NewRoundRobin creates a round-robin strategy
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+// Pick returns the candidate after the one picked last time
+func (rr *RoundRobin) Pick(candidates []ProxyInfo, key string) ProxyInfo {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	proxy := candidates[rr.next%len(candidates)]
+	rr.next = (rr.next + 1) % len(candidates)
+	return proxy
+}
+
+// WeightedRandom picks candidates at random, in proportion to a weight
+type WeightedRandom struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	weight func(ProxyInfo) float64
+}
+
+// NewWeightedRandom creates a strategy drawing from src. A nil weight uses
+// ScoreWeight. Pass a fixed source for reproducible picks.
+func NewWeightedRandom(src rand.Source, weight func(ProxyInfo) float64) *WeightedRandom {
+	if weight == nil {
+		weight = ScoreWeight
+	}
+	return &WeightedRandom{
+		rng:    rand.New(src),
+		weight: weight,
+	}
+}
+
+// Pick draws a candidate. Candidates with a weight of zero or less are
+// only picked when no candidate has a positive weight.
+func (wr *WeightedRandom) Pick(candidates []ProxyInfo, key string) ProxyInfo {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, proxy := range candidates {
+		if w := wr.weight(proxy); w > 0 {
+			weights[i] = w
+			total += w
+		}
+	}
+	if total == 0 {
+		return candidates[wr.rng.Intn(len(candidates))]
+	}
+
+	r := wr.rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return candidates[i]
+		}
+		r -= w
+	}
+
+	// Rounding can leave r just above the last weight
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return candidates[i]
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// ScoreWeight weighs proxies by their score, falling back to LatencyWeight
+// for proxies that have not been scored
+func ScoreWeight(proxy ProxyInfo) float64 {
+	if proxy.Score > 0 {
+		return proxy.Score
+	}
+	return LatencyWeight(proxy)
+}
+
+// LatencyWeight favours fast proxies: the weight is the inverse of the
+// latency in seconds. Proxies without a measured latency get a weight of
+// one, as if they took a second.
+func LatencyWeight(proxy ProxyInfo) float64 {
+	if proxy.Latency <= 0 {
+		return 1
+	}
+	return 1 / proxy.Latency.Seconds()
+}
+
+// LeastRecentlyUsed picks the candidate handed out longest ago, so every
+// proxy gets the same rest between uses
+type LeastRecentlyUsed struct{}
+
+// Pick returns the candidate with the oldest LastUsed, the first one on
+// ties
+func (LeastRecentlyUsed) Pick(candidates []ProxyInfo, key string) ProxyInfo {
+	best := 0
+	for i, proxy := range candidates {
+		if proxy.LastUsed.Before(candidates[best].LastUsed) {
+			best = i
+		}
+	}
+	return candidates[best]
+}
+
+// LeastInFlight picks the candidate with the fewest requests in flight,
+// so a slow proxy does not pile up work
+type LeastInFlight struct{}
+
+// Pick returns the candidate with the lowest InFlight, the least recently
+// used one on ties
+func (LeastInFlight) Pick(candidates []ProxyInfo, key string) ProxyInfo {
+	best := 0
+	for i, proxy := range candidates {
+		current := candidates[best]
+		if proxy.InFlight < current.InFlight ||
+			(proxy.InFlight == current.InFlight && proxy.LastUsed.Before(current.LastUsed)) {
+			best = i
+		}
+	}
+	return candidates[best]
+}
+
+// Sticky maps a session key to the same proxy for as long as that proxy
+// stays among the candidates. It uses rendezvous hashing, so a proxy
+// leaving the pool only moves the keys that were mapped to it.
+type Sticky struct {
+	fallback Strategy
+}
+
+// NewSticky creates a sticky strategy. Picks without a key go to fallback,
+// LeastInFlight when nil.
+func NewSticky(fallback Strategy) *Sticky {
+	if fallback == nil {
+		fallback = LeastInFlight{}
+	}
+	return &Sticky{fallback: fallback}
+}
+
+// Pick returns the candidate with the highest hash of key and address
+func (s *Sticky) Pick(candidates []ProxyInfo, key string) ProxyInfo {
+	if key == "" {
+		return s.fallback.Pick(candidates, key)
+	}
+
+	best := 0
+	bestScore := uint64(0)
+	for i, proxy := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(proxy.Address))
+		if score := h.Sum64(); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return candidates[best]
+}
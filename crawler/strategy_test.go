@@ -0,0 +1,222 @@
+package crawler
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testCandidates returns n candidates with addresses 10.0.0.1:8080 and up
+func testCandidates(n int) []ProxyInfo {
+	candidates := make([]ProxyInfo, n)
+	for i := range candidates {
+		candidates[i] = ProxyInfo{Address: fmt.Sprintf("10.0.0.%d:8080", i+1)}
+	}
+	return candidates
+}
+
+func TestRoundRobinOrder(t *testing.T) {
+	candidates := testCandidates(3)
+	rr := NewRoundRobin()
+
+	want := []int{0, 1, 2, 0, 1, 2, 0}
+	for i, index := range want {
+		if got := rr.Pick(candidates, ""); got.Address != candidates[index].Address {
+			t.Fatalf("pick %d: got %s, want %s", i, got.Address, candidates[index].Address)
+		}
+	}
+}
+
+func TestRoundRobinShrinkingPool(t *testing.T) {
+	rr := NewRoundRobin()
+	rr.Pick(testCandidates(5), "")
+	rr.Pick(testCandidates(5), "")
+	rr.Pick(testCandidates(5), "")
+
+	// The position wraps around when the pool shrinks below it
+	candidates := testCandidates(2)
+	if got := rr.Pick(candidates, ""); got.Address != candidates[1].Address {
+		t.Fatalf("got %s, want %s", got.Address, candidates[1].Address)
+	}
+	if got := rr.Pick(candidates, ""); got.Address != candidates[0].Address {
+		t.Fatalf("got %s, want %s", got.Address, candidates[0].Address)
+	}
+}
+
+func TestWeightedRandomProportions(t *testing.T) {
+	candidates := testCandidates(3)
+	weights := map[string]float64{
+		candidates[0].Address: 1,
+		candidates[1].Address: 3,
+		candidates[2].Address: 0,
+	}
+	wr := NewWeightedRandom(rand.NewSource(1), func(proxy ProxyInfo) float64 {
+		return weights[proxy.Address]
+	})
+
+	const draws = 10000
+	counts := make(map[string]int)
+	for i := 0; i < draws; i++ {
+		counts[wr.Pick(candidates, "").Address]++
+	}
+
+	if counts[candidates[2].Address] != 0 {
+		t.Errorf("zero-weight candidate picked %d times", counts[candidates[2].Address])
+	}
+	share := float64(counts[candidates[1].Address]) / draws
+	if share < 0.72 || share > 0.78 {
+		t.Errorf("candidate with 3/4 of the weight got %.3f of the picks", share)
+	}
+}
+
+func TestWeightedRandomReproducible(t *testing.T) {
+	candidates := testCandidates(5)
+	a := NewWeightedRandom(rand.NewSource(1), nil)
+	b := NewWeightedRandom(rand.NewSource(1), nil)
+
+	for i := 0; i < 100; i++ {
+		if pa, pb := a.Pick(candidates, ""), b.Pick(candidates, ""); pa.Address != pb.Address {
+			t.Fatalf("pick %d: %s and %s from the same seed", i, pa.Address, pb.Address)
+		}
+	}
+}
+
+func TestWeightedRandomAllZeroWeights(t *testing.T) {
+	candidates := testCandidates(4)
+	wr := NewWeightedRandom(rand.NewSource(1), func(ProxyInfo) float64 { return 0 })
+
+	// Without a positive weight the pick is uniform over all candidates
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[wr.Pick(candidates, "").Address]++
+	}
+	for _, proxy := range candidates {
+		if counts[proxy.Address] == 0 {
+			t.Errorf("%s never picked", proxy.Address)
+		}
+	}
+}
+
+func TestLatencyWeight(t *testing.T) {
+	tests := []struct {
+		latency time.Duration
+		want    float64
+	}{
+		{0, 1},
+		{500 * time.Millisecond, 2},
+		{2 * time.Second, 0.5},
+	}
+	for _, tt := range tests {
+		if got := LatencyWeight(ProxyInfo{Latency: tt.latency}); got != tt.want {
+			t.Errorf("LatencyWeight(%v) = %v, want %v", tt.latency, got, tt.want)
+		}
+	}
+}
+
+func TestLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	candidates := testCandidates(3)
+	candidates[0].LastUsed = now
+	candidates[1].LastUsed = now.Add(-time.Minute)
+	candidates[2].LastUsed = now.Add(-time.Minute)
+
+	// Ties go to the first candidate
+	if got := (LeastRecentlyUsed{}).Pick(candidates, ""); got.Address != candidates[1].Address {
+		t.Fatalf("got %s, want %s", got.Address, candidates[1].Address)
+	}
+
+	// Never used proxies come first
+	candidates[2].LastUsed = time.Time{}
+	if got := (LeastRecentlyUsed{}).Pick(candidates, ""); got.Address != candidates[2].Address {
+		t.Fatalf("got %s, want %s", got.Address, candidates[2].Address)
+	}
+}
+
+func TestLeastInFlight(t *testing.T) {
+	now := time.Now()
+	candidates := testCandidates(4)
+	candidates[0].InFlight = 2
+	candidates[1].InFlight = 1
+	candidates[1].LastUsed = now
+	candidates[2].InFlight = 1
+	candidates[2].LastUsed = now.Add(-time.Minute)
+	candidates[3].InFlight = 3
+
+	// Ties on InFlight go to the least recently used candidate
+	if got := (LeastInFlight{}).Pick(candidates, ""); got.Address != candidates[2].Address {
+		t.Fatalf("got %s, want %s", got.Address, candidates[2].Address)
+	}
+
+	// Full ties go to the first candidate
+	candidates[2].LastUsed = now
+	if got := (LeastInFlight{}).Pick(candidates, ""); got.Address != candidates[1].Address {
+		t.Fatalf("got %s, want %s", got.Address, candidates[1].Address)
+	}
+}
+
+func TestStickySameKey(t *testing.T) {
+	candidates := testCandidates(10)
+	sticky := NewSticky(nil)
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		first := sticky.Pick(candidates, key)
+		for j := 0; j < 3; j++ {
+			if got := sticky.Pick(candidates, key); got.Address != first.Address {
+				t.Fatalf("key %s moved from %s to %s", key, first.Address, got.Address)
+			}
+		}
+	}
+}
+
+func TestStickyRemovalMovesOnlyItsKeys(t *testing.T) {
+	candidates := testCandidates(10)
+	sticky := NewSticky(nil)
+
+	const keys = 1000
+	before := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		before[key] = sticky.Pick(candidates, key).Address
+	}
+
+	removed := candidates[3].Address
+	remaining := append(append([]ProxyInfo(nil), candidates[:3]...), candidates[4:]...)
+
+	moved := 0
+	for key, address := range before {
+		got := sticky.Pick(remaining, key).Address
+		if address == removed {
+			moved++
+			continue
+		}
+		if got != address {
+			t.Errorf("key %s moved from %s to %s, but only keys of %s should move", key, address, got, removed)
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("no key was mapped to %s", removed)
+	}
+}
+
+func TestStickyWithoutKeyUsesFallback(t *testing.T) {
+	candidates := testCandidates(3)
+	candidates[0].InFlight = 1
+	candidates[2].InFlight = 1
+
+	if got := NewSticky(nil).Pick(candidates, ""); got.Address != candidates[1].Address {
+		t.Fatalf("got %s, want %s", got.Address, candidates[1].Address)
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range StrategyNames {
+		if _, err := NewStrategy(name); err != nil {
+			t.Errorf("NewStrategy(%q): %v", name, err)
+		}
+	}
+	if _, err := NewStrategy("fastest"); err == nil {
+		t.Error("NewStrategy accepted an unknown name")
+	}
+}
@@ -3,37 +3,49 @@ package crawler
 import (
 	"context"
 	"fmt"
-	"net"
+	"io"
 	"net/http"
-	"net/url"
-	"sync"
 	"time"
 )
 
 // ProxyTester handles proxy testing operations
 type ProxyTester struct {
+	name       string
 	testURL    string
 	timeout    time.Duration
 	maxWorkers int
+	runner     *Runner
 }
 
 // ProxyResult represents the result of a proxy test
-type ProxyResult struct {
-	Proxy     string
-	IsWorking bool
-	Latency   time.Duration
-	Error     error
-}
+type ProxyResult = CheckResult
 
 // NewProxyTester creates a new proxy tester
 func NewProxyTester() *ProxyTester {
 	return &ProxyTester{
+		name:       "httpbin",
 		testURL:    "http://httpbin.org/ip",
 		timeout:    10 * time.Second,
 		maxWorkers: 50,
+		runner:     NewRunner(50),
 	}
 }
 
+// Name returns the name of the check
+func (pt *ProxyTester) Name() string {
+	return pt.name
+}
+
+// SetName sets the name the check reports in results
+func (pt *ProxyTester) SetName(name string) {
+	pt.name = name
+}
+
+// Check tests a single proxy, implementing Checker
+func (pt *ProxyTester) Check(ctx context.Context, proxy string) CheckResult {
+	return pt.testProxy(ctx, proxy)
+}
+
 // SetTestURL sets the URL to test against
 func (pt *ProxyTester) SetTestURL(testURL string) {
 	pt.testURL = testURL
@@ -47,6 +59,13 @@ func (pt *ProxyTester) SetTimeout(timeout time.Duration) {
 // SetMaxWorkers sets the maximum number of concurrent workers
 func (pt *ProxyTester) SetMaxWorkers(workers int) {
 	pt.maxWorkers = workers
+	pt.runner.SetMaxWorkers(workers)
+}
+
+// SetLimiter makes TestProxies adapt its concurrency with limiter instead
+// of using a fixed number of workers
+func (pt *ProxyTester) SetLimiter(limiter *AdaptiveLimiter) {
+	pt.runner.SetLimiter(limiter)
 }
 
 // TestProxies tests a list of proxies and returns working ones
@@ -54,48 +73,19 @@ func (pt *ProxyTester) TestProxies(ctx context.Context, proxies []string) ([]str
 	fmt.Printf("🔍 Testing %d proxies...\n", len(proxies))
 	startTime := time.Now()
 
-	results := make(chan ProxyResult, len(proxies))
-	semaphore := make(chan struct{}, pt.maxWorkers)
-	var wg sync.WaitGroup
-
-	// Test proxies concurrently
-	for _, proxy := range proxies {
-		wg.Add(1)
-		go func(p string) {
-			defer wg.Done()
-
-			// Acquire semaphore
-			select {
-			case semaphore <- struct{}{}:
-			case <-ctx.Done():
-				return
-			}
-			defer func() { <-semaphore }()
-
-			result := pt.testProxy(ctx, p)
-			results <- result
-		}(proxy)
-	}
-
-	// Close results channel when all goroutines are done
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
 	// Collect working proxies
 	var workingProxies []string
 	totalTested := 0
 	workingCount := 0
 
-	for result := range results {
+	collect := func(result ProxyResult) {
 		totalTested++
 		if result.IsWorking {
 			workingProxies = append(workingProxies, result.Proxy)
 			workingCount++
 			fmt.Printf("✓ %s (%.2fms)\n", result.Proxy, float64(result.Latency.Nanoseconds())/1000000)
 		} else if result.Error != nil {
-			fmt.Printf("✗ %s: %v\n", result.Proxy, result.Error)
+			fmt.Printf("✗ %s [%s]: %v\n", result.Proxy, result.ErrorClass, result.Error)
 		}
 
 		// Show progress every 10 tests
@@ -104,6 +94,8 @@ func (pt *ProxyTester) TestProxies(ctx context.Context, proxies []string) ([]str
 		}
 	}
 
+	runErr := pt.runner.RunFunc(ctx, pt, proxies, collect)
+
 	endTime := time.Now()
 	fmt.Printf("\n📊 Test Results:\n")
 	fmt.Printf("   Total tested: %d\n", totalTested)
@@ -111,43 +103,32 @@ func (pt *ProxyTester) TestProxies(ctx context.Context, proxies []string) ([]str
 	fmt.Printf("   Success rate: %.2f%%\n", float64(workingCount)/float64(totalTested)*100)
 	fmt.Printf("   Test time: %.2fs\n", endTime.Sub(startTime).Seconds())
 
-	return workingProxies, nil
+	return workingProxies, runErr
 }
 
 // testProxy tests a single proxy
 func (pt *ProxyTester) testProxy(ctx context.Context, proxy string) ProxyResult {
 	result := ProxyResult{
 		Proxy:     proxy,
+		Check:     pt.Name(),
 		IsWorking: false,
 	}
 
 	startTime := time.Now()
 
-	// Create proxy URL
-	proxyURL, err := url.Parse("http://" + proxy)
+	// Create HTTP client with proxy
+	client, err := NewProxyClient(ctx, proxy, pt.timeout)
 	if err != nil {
-		result.Error = fmt.Errorf("invalid proxy URL: %v", err)
+		result.Error = err
+		result.ErrorClass = ClassUnknown
 		return result
 	}
 
-	// Create HTTP client with proxy
-	transport := &http.Transport{
-		Proxy: http.ProxyURL(proxyURL),
-		DialContext: (&net.Dialer{
-			Timeout: pt.timeout,
-		}).DialContext,
-		DisableKeepAlives: true,
-	}
-
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   pt.timeout,
-	}
-
 	// Create request with context
 	req, err := http.NewRequestWithContext(ctx, "GET", pt.testURL, nil)
 	if err != nil {
 		result.Error = fmt.Errorf("error creating request: %v", err)
+		result.ErrorClass = ClassUnknown
 		return result
 	}
 
@@ -157,16 +138,27 @@ func (pt *ProxyTester) testProxy(ctx context.Context, proxy string) ProxyResult
 	resp, err := client.Do(req)
 	if err != nil {
 		result.Error = err
+		result.ErrorClass = ClassifyError(err)
+		if ctx.Err() != nil {
+			result.ErrorClass = ClassCanceled
+		}
 		return result
 	}
 	defer resp.Body.Close()
 
 	result.Latency = time.Since(startTime)
+	result.StatusCode = resp.StatusCode
 
 	if resp.StatusCode == http.StatusOK {
 		result.IsWorking = true
+
+		// httpbin.org/ip echoes the exit IP, record it for free
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		result.ResponseLen = len(body)
+		result.ExitIP = ParseExitIP(body)
 	} else {
-		result.Error = fmt.Errorf("HTTP %d", resp.StatusCode)
+		result.ErrorClass = ClassifyStatus(resp.StatusCode)
+		result.Error = NewTestError(result.ErrorClass, fmt.Errorf("HTTP %d", resp.StatusCode))
 	}
 
 	return result
@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ThroughputTester measures how fast a proxy can move data by downloading
+// a payload through it
+type ThroughputTester struct {
+	testURL  string
+	maxBytes int64
+	timeout  time.Duration
+}
+
+// ThroughputResult represents the result of a throughput test
+type ThroughputResult struct {
+	Proxy          string
+	Bytes          int64
+	Duration       time.Duration
+	BytesPerSecond float64
+	Error          error
+}
+
+// NewThroughputTester creates a new throughput tester that downloads at most
+// maxBytes from testURL through each proxy
+func NewThroughputTester(testURL string, maxBytes int64, timeout time.Duration) *ThroughputTester {
+	return &ThroughputTester{
+		testURL:  testURL,
+		maxBytes: maxBytes,
+		timeout:  timeout,
+	}
+}
+
+// TestProxy downloads the payload through a single proxy and records the
+// transfer rate. The clock starts once the response headers arrive, so the
+// rate reflects the body transfer rather than the handshake.
+func (tt *ThroughputTester) TestProxy(ctx context.Context, proxy string) ThroughputResult {
+	result := ThroughputResult{
+		Proxy: proxy,
+	}
+
+	// Create HTTP client with proxy
+	transport, err := NewProxyTransport(ctx, proxy, tt.timeout)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	transport.DisableCompression = true
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   tt.timeout,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tt.testURL, nil)
+	if err != nil {
+		result.Error = fmt.Errorf("error creating request: %v", err)
+		return result
+	}
+
+	req.Header.Set("User-Agent", "ProxyTester/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Errorf("HTTP %d", resp.StatusCode)
+		return result
+	}
+
+	startTime := time.Now()
+	n, err := io.CopyN(io.Discard, resp.Body, tt.maxBytes)
+	result.Duration = time.Since(startTime)
+	result.Bytes = n
+
+	// A short payload is fine, anything else cut the transfer off
+	if err != nil && err != io.EOF {
+		result.Error = fmt.Errorf("error reading payload after %d bytes: %v", n, err)
+		return result
+	}
+
+	if n == 0 {
+		result.Error = fmt.Errorf("empty payload")
+		return result
+	}
+
+	if result.Duration > 0 {
+		result.BytesPerSecond = float64(n) / result.Duration.Seconds()
+	}
+
+	return result
+}
+
+// TestProxies measures throughput for multiple proxies concurrently
+func (tt *ThroughputTester) TestProxies(ctx context.Context, proxies []string, maxWorkers int) []ThroughputResult {
+	results := make([]ThroughputResult, 0, len(proxies))
+
+	RunPool(ctx, proxies, maxWorkers, tt.TestProxy, func(result ThroughputResult) {
+		results = append(results, result)
+	})
+
+	return results
+}
+
+// FormatBytesPerSecond formats a transfer rate for display
+func FormatBytesPerSecond(bps float64) string {
+	switch {
+	case bps >= 1024*1024:
+		return fmt.Sprintf("%.2f MB/s", bps/(1024*1024))
+	case bps >= 1024:
+		return fmt.Sprintf("%.2f KB/s", bps/1024)
+	default:
+		return fmt.Sprintf("%.0f B/s", bps)
+	}
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"fmt"
+	"regproxy/api"
+	"regproxy/config"
+	"regproxy/crawler"
+	"time"
+)
+
+// NewChecker creates the proxy check selected by daemon.check in the config
+func NewChecker(cfg *config.Config) (crawler.Checker, error) {
+	return NewCheckerByName(cfg, cfg.Daemon.Check)
+}
+
+// NewCheckerByName creates the named check from the checks section, or one
+// of the presets when no check with that name is declared
+func NewCheckerByName(cfg *config.Config, name string) (crawler.Checker, error) {
+	check, ok := cfg.GetCheck(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown check %q", name)
+	}
+
+	timeout := cfg.GetCheckTimeout(check)
+
+	switch check.Preset {
+	case config.PresetElevenLabs:
+		apiURL := cfg.API.ElevenLabs.URL
+		if check.URL != "" {
+			apiURL = check.URL
+		}
+		payload := cfg.API.ElevenLabs.TestPayload
+		if check.Body != "" {
+			payload = check.Body
+		}
+		apiKey, err := cfg.ElevenLabsKey()
+		if err != nil {
+			return nil, err
+		}
+		tester := api.NewElevenLabsTester(apiKey, apiURL, payload, timeout)
+		tester.SetName(check.Name)
+		if check.MaxBodyBytes > 0 {
+			tester.SetMaxBodyBytes(check.MaxBodyBytes)
+		}
+		tester.SetMode(api.ElevenLabsMode(cfg.API.ElevenLabs.Mode))
+		tester.SetLightURL(cfg.API.ElevenLabs.LightURL)
+		tester.SetFullCheckSchedule(cfg.GetFullCheckInterval(), cfg.API.ElevenLabs.FullCheckSampleRate)
+		return tester, nil
+
+	case config.PresetHTTPBin:
+		tester := crawler.NewProxyTester()
+		tester.SetName(check.Name)
+		tester.SetTimeout(timeout)
+		if check.URL != "" {
+			tester.SetTestURL(check.URL)
+		}
+		return tester, nil
+
+	case "":
+		headers, err := check.ResolveHeaders()
+		if err != nil {
+			return nil, err
+		}
+		return api.NewHTTPCheck(api.HTTPCheckSpec{
+			Name:         check.Name,
+			Method:       check.Method,
+			URL:          check.URL,
+			Headers:      headers,
+			Body:         check.Body,
+			MinStatus:    check.ExpectStatus.Min,
+			MaxStatus:    check.ExpectStatus.Max,
+			BodyContains: check.BodyContains,
+			BodyRegex:    check.BodyRegex,
+			MaxBodyBytes: check.MaxBodyBytes,
+			Timeout:      timeout,
+		})
+
+	default:
+		return nil, fmt.Errorf("check %q: unknown preset %q", name, check.Preset)
+	}
+}
+
+// NewStabilityChecker wraps checker to sample each proxy repeatedly as set
+// up in the stability section of the config
+func NewStabilityChecker(cfg *config.Config, checker crawler.Checker) crawler.Checker {
+	return crawler.NewStabilityChecker(checker, cfg.Stability.Samples, cfg.GetStabilityWindow(),
+		crawler.StabilityThresholds{
+			MinSuccessRatio: cfg.Stability.MinSuccessRatio,
+			MaxP95Latency:   time.Duration(cfg.Stability.MaxP95LatencyMs) * time.Millisecond,
+			MaxJitter:       time.Duration(cfg.Stability.MaxJitterMs) * time.Millisecond,
+		})
+}
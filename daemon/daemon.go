@@ -2,32 +2,71 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	stdlog "log"
+	"net/http"
 	"os"
 	"os/signal"
-	"regproxy/api"
 	"regproxy/config"
 	"regproxy/crawler"
+	"regproxy/geoip"
 	"regproxy/logger"
 	"regproxy/storage"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 // Daemon represents the proxy testing daemon
 type Daemon struct {
-	config          *config.Config
-	crawler         *crawler.Crawler
-	tester          *api.ElevenLabsTester
-	mongoStorage    *storage.MongoStorage
-	workingProxies  []string
-	logger          *logger.Logger
-	lastCrawlTime   time.Time
-	ctx             context.Context
-	cancel          context.CancelFunc
+	config           *config.Config
+	crawler          *crawler.Crawler
+	checkers         map[string]crawler.Checker
+	stableCheckers   map[string]crawler.Checker
+	checkOrder       []string
+	targetOrder      []string
+	profiles         []config.ProfileConfig
+	runner           *crawler.Runner
+	throughputTester *crawler.ThroughputTester
+	exitIPDetector   *crawler.ExitIPDetector
+	exitIPs          map[string]string
+	manager          *crawler.ProxyManager
+	scorer           *crawler.Scorer
+	history          map[string]crawler.ProxyHistory
+	lifecycle        *crawler.Lifecycle
+	states           map[string]crawler.ProxyStatus
+	types            map[string]crawler.ProxyType
+	diversity        crawler.DiversityRules
+	geoip            *geoip.Enricher
+	prefilter        *crawler.Prefilter
+	mongoStorage     *storage.MongoStorage
+	httpServer       *http.Server
+	workingSets      map[string][]string
+	lastCycle        crawler.ProxyStats
+	lastUsage        map[string]int64
+	totalUsage       map[string]int64
+	lastAlert        string
+	lastAlertTime    time.Time
+	logger           *logger.Logger
+	lastCrawlTime    time.Time
+	startTime        time.Time
+	ctx              context.Context
+	cancel           context.CancelFunc
+
+	// cycleMu is held by whichever crawl or test cycle is running, and
+	// ready is set once the proxies loaded on start have been revalidated
+	cycleMu sync.Mutex
+	ready   atomic.Bool
+
+	// mu guards what other goroutines read: the stats published after
+	// each cycle and the cycle history
+	mu        sync.RWMutex
+	published Stats
+	cycles    []CycleRecord
 }
 
 // NewDaemon creates a new daemon instance
@@ -43,19 +82,113 @@ func NewDaemon(cfg *config.Config) (*Daemon, error) {
 	proxyCrawler.SetMaxWorkers(cfg.Proxy.MaxCrawlWorkers)
 	proxyCrawler.SetTimeout(cfg.GetTimeout())
 
-	// Create ElevenLabs tester
-	tester := api.NewElevenLabsTester(cfg.API.ElevenLabs.Key, cfg.API.ElevenLabs.URL, cfg.API.ElevenLabs.TestPayload, cfg.GetTimeout())
+	// Create every check the profiles and reachability targets need
+	checkers := make(map[string]crawler.Checker)
+	checkOrder := cfg.ProfileChecks()
+	targetOrder := cfg.TargetChecks()
+	for _, name := range cfg.UsedChecks() {
+		checker, err := NewCheckerByName(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		checkers[name] = checker
+	}
+
+	// New candidates are sampled repeatedly before they are promoted
+	var stableCheckers map[string]crawler.Checker
+	if cfg.Stability.Enabled {
+		stableCheckers = make(map[string]crawler.Checker, len(checkers))
+		for name, checker := range checkers {
+			stableCheckers[name] = NewStabilityChecker(cfg, checker)
+		}
+		log.Info("Stability sampling enabled (%d samples over %v, min success ratio %.2f)",
+			cfg.Stability.Samples, cfg.GetStabilityWindow(), cfg.Stability.MinSuccessRatio)
+	}
+
+	profiles := cfg.GetProfiles()
+	for _, profile := range profiles {
+		log.Info("Profile %s: checks %s, keeping %d proxies in %s", profile.Name,
+			strings.Join(profile.Checks, ", "), profile.KeepWorkingProxies, profile.WorkingProxies)
+	}
+
+	// Let the runner find its own concurrency level if enabled
+	runner := crawler.NewRunner(cfg.Daemon.Threads)
+	runner.SetBreakerThreshold(cfg.Daemon.TargetErrorLimit)
+	if cfg.Daemon.AdaptiveConcurrency {
+		limiter := crawler.NewAdaptiveLimiter(cfg.Daemon.MinThreads, cfg.Daemon.MaxThreads, cfg.Daemon.Threads)
+		runner.SetLimiter(limiter)
+		log.Info("Adaptive concurrency enabled (%d-%d threads, starting at %d)",
+			cfg.Daemon.MinThreads, cfg.Daemon.MaxThreads, limiter.Limit())
+	}
+
+	// Consumer feedback on leased proxies feeds the same scoring model
+	scorer := NewScorer(cfg)
+	manager := crawler.NewProxyManager()
+	manager.SetScorer(scorer)
+	manager.SetFailureLimit(cfg.Lease.FailureLimit)
 
 	// Create context
 	ctx, cancel := context.WithCancel(context.Background())
 
 	daemon := &Daemon{
-		config:  cfg,
-		crawler: proxyCrawler,
-		tester:  tester,
-		logger:  log,
-		ctx:     ctx,
-		cancel:  cancel,
+		config:         cfg,
+		crawler:        proxyCrawler,
+		checkers:       checkers,
+		stableCheckers: stableCheckers,
+		checkOrder:     checkOrder,
+		targetOrder:    targetOrder,
+		profiles:       profiles,
+		runner:         runner,
+		workingSets:    make(map[string][]string),
+		exitIPs:        make(map[string]string),
+		manager:        manager,
+		scorer:         scorer,
+		history:        make(map[string]crawler.ProxyHistory),
+		lifecycle:      NewLifecycle(cfg),
+		states:         make(map[string]crawler.ProxyStatus),
+		types:          make(map[string]crawler.ProxyType),
+		diversity:      NewDiversityRules(cfg),
+		lastUsage:      make(map[string]int64),
+		totalUsage:     make(map[string]int64),
+		logger:         log,
+		startTime:      time.Now(),
+		lastCycle:      crawler.ComputeStats(nil),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+
+	// Create prefilter if enabled
+	if cfg.Prefilter.Enabled {
+		daemon.prefilter = crawler.NewPrefilter()
+		daemon.prefilter.SetTimeout(cfg.GetPrefilterTimeout())
+		daemon.prefilter.SetMaxWorkers(cfg.Prefilter.Workers)
+		daemon.prefilter.SetTarget(cfg.Prefilter.Target)
+		log.Info("TCP/handshake prefilter enabled (%d workers, %v timeout)", cfg.Prefilter.Workers, cfg.GetPrefilterTimeout())
+	}
+
+	// Create throughput tester if enabled
+	if cfg.Throughput.Enabled {
+		daemon.throughputTester = crawler.NewThroughputTester(cfg.Throughput.URL, cfg.Throughput.MaxBytes, cfg.GetThroughputTimeout())
+		log.Info("Throughput testing enabled (%s, up to %d bytes)", cfg.Throughput.URL, cfg.Throughput.MaxBytes)
+	}
+
+	// Create exit IP detector if enabled
+	if cfg.ExitIP.Enabled {
+		daemon.exitIPDetector = crawler.NewExitIPDetector(cfg.ExitIP.JudgeURL, cfg.GetExitIPTimeout())
+		daemon.exitIPDetector.SetMaxWorkers(cfg.Daemon.Threads)
+		log.Info("Exit IP detection enabled (%s, at most %d proxies per exit IP)",
+			cfg.ExitIP.JudgeURL, cfg.ExitIP.MaxPerExitIP)
+	}
+
+	// Open GeoIP databases if enabled
+	if cfg.GeoIP.Enabled {
+		enricher, err := geoip.OpenFiles(cfg.GetGeoIPFiles())
+		if err != nil {
+			log.Warn("GeoIP enrichment disabled: %v", err)
+		} else {
+			daemon.geoip = enricher
+			log.Info("GeoIP enrichment enabled (%s)", strings.Join(enricher.Databases(), ", "))
+		}
 	}
 
 	// Initialize MongoDB if enabled
@@ -72,10 +205,37 @@ func NewDaemon(cfg *config.Config) (*Daemon, error) {
 		}
 	}
 
-	// Load existing working proxies
-	if err := daemon.loadWorkingProxies(); err != nil {
-		log.Warn("Could not load existing working proxies: %v", err)
+	// Create the HTTP API if enabled
+	if cfg.Server.Enabled {
+		token, err := cfg.ServerToken()
+		if err != nil {
+			return nil, err
+		}
+		daemon.httpServer = &http.Server{
+			Addr:              cfg.Server.Listen,
+			Handler:           daemon.Handler(token),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+
+	// Restore the full proxy state from the snapshot, falling back to the
+	// working proxies and states stored elsewhere
+	restored, err := daemon.restoreSnapshot()
+	if err != nil {
+		log.Warn("Could not restore snapshot: %v", err)
+	}
+	if !restored {
+		if err := daemon.loadWorkingProxies(); err != nil {
+			log.Warn("Could not load existing working proxies: %v", err)
+		}
+	}
+	daemon.syncManager(nil, nil, nil)
+	if !restored {
+		if err := daemon.loadStates(); err != nil {
+			log.Warn("Could not load proxy states: %v", err)
+		}
 	}
+	daemon.publishStats()
 
 	return daemon, nil
 }
@@ -88,12 +248,35 @@ func (d *Daemon) Run() error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Initial proxy crawling if needed
-	if len(d.workingProxies) == 0 {
-		d.logger.Info("No working proxies found, performing initial crawl...")
-		if err := d.crawlAndTestProxies(); err != nil {
-			d.logger.Info("Error in initial crawl: %v", err)
-		}
+	// Hold the cycle lock from before the HTTP API is served, so a cycle
+	// triggered through it cannot change the decision below or run before
+	// the initial crawl or revalidation
+	d.cycleMu.Lock()
+	initialCrawl := len(d.GetWorkingProxies()) == 0
+
+	// Serve the HTTP API while the daemon starts, /healthz reports when it
+	// is ready
+	if d.httpServer != nil {
+		go func() {
+			if err := d.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				d.logger.Error("HTTP API stopped: %v", err)
+			}
+		}()
+		d.logger.Info("HTTP API listening on %s", d.httpServer.Addr)
+	}
+
+	// Initial proxy crawling if needed, otherwise the loaded proxies are
+	// revalidated in the background while they are already served
+	if initialCrawl {
+		d.finishCycle(func() {
+			d.logger.Info("No working proxies found, performing initial crawl...")
+			if err := d.crawlAndTestProxies(); err != nil {
+				d.logger.Info("Error in initial crawl: %v", err)
+			}
+		})
+		d.ready.Store(true)
+	} else {
+		go d.revalidate()
 	}
 
 	// Main daemon loop
@@ -103,8 +286,12 @@ func (d *Daemon) Run() error {
 	crawlTicker := time.NewTicker(d.config.GetSourcesRefreshInterval())
 	defer crawlTicker.Stop()
 
+	// Suspect and quarantined proxies are retested on their own schedule
+	retestTicker := time.NewTicker(d.config.GetSuspectInterval())
+	defer retestTicker.Stop()
+
 	d.logger.Info("Daemon running with %d working proxies. Testing every %v", 
-		len(d.workingProxies), d.config.GetInterval())
+		d.manager.WorkingCount(), d.config.GetInterval())
 
 	for {
 		select {
@@ -114,16 +301,30 @@ func (d *Daemon) Run() error {
 			return d.shutdown()
 
 		case <-ticker.C:
-			d.logger.Info("Starting proxy test cycle...")
-			if err := d.testExistingProxies(); err != nil {
-				d.logger.Info("Error testing proxies: %v", err)
-			}
+			d.runCycle("test", func() {
+				d.logger.Info("Starting proxy test cycle...")
+				if err := d.testExistingProxies(); err != nil {
+					d.logger.Info("Error testing proxies: %v", err)
+				}
+			})
 
 		case <-crawlTicker.C:
-			d.logger.Info("Starting proxy crawl cycle...")
-			if err := d.crawlAndTestProxies(); err != nil {
-				d.logger.Info("Error crawling proxies: %v", err)
-			}
+			d.runCycle("crawl", func() {
+				d.logger.Info("Starting proxy crawl cycle...")
+				if err := d.crawlAndTestProxies(); err != nil {
+					d.logger.Info("Error crawling proxies: %v", err)
+				}
+			})
+
+		case <-retestTicker.C:
+			d.runCycle("retest", func() {
+				if due := d.dueRetests(time.Now()); len(due) > 0 {
+					d.logger.Info("Retesting %d suspect and quarantined proxies...", len(due))
+					if err := d.testProxies(due, "retest"); err != nil {
+						d.logger.Info("Error retesting proxies: %v", err)
+					}
+				}
+			})
 
 		case <-d.ctx.Done():
 			return nil
@@ -131,6 +332,59 @@ func (d *Daemon) Run() error {
 	}
 }
 
+// runCycle runs a crawl or test cycle, skipping it while another one such
+// as the startup revalidation is still running
+func (d *Daemon) runCycle(name string, cycle func()) {
+	if !d.tryCycle(name) {
+		return
+	}
+	d.finishCycle(cycle)
+}
+
+// startCycle runs a cycle in the background and reports false when
+// another cycle is still running
+func (d *Daemon) startCycle(name string, cycle func()) bool {
+	if !d.tryCycle(name) {
+		return false
+	}
+	go d.finishCycle(cycle)
+	return true
+}
+
+// tryCycle takes the cycle lock unless another cycle holds it
+func (d *Daemon) tryCycle(name string) bool {
+	if !d.cycleMu.TryLock() {
+		d.logger.Info("Skipping %s cycle, the previous cycle is still running", name)
+		return false
+	}
+	return true
+}
+
+// finishCycle runs cycle, publishes its stats and releases the cycle lock
+func (d *Daemon) finishCycle(cycle func()) {
+	defer d.cycleMu.Unlock()
+	cycle()
+	d.publishStats()
+}
+
+// revalidate retests the proxies loaded on start and then marks the
+// daemon ready. The caller holds the cycle lock.
+func (d *Daemon) revalidate() {
+	d.finishCycle(func() {
+		d.logger.Info("Revalidating %d loaded proxies in the background...", len(d.GetWorkingProxies()))
+		if err := d.testExistingProxies(); err != nil {
+			d.logger.Info("Error revalidating proxies: %v", err)
+		}
+	})
+	d.ready.Store(true)
+	d.logger.Info("✅ Daemon ready with %d working proxies", d.manager.WorkingCount())
+}
+
+// Ready reports whether the proxies loaded on start have been revalidated
+func (d *Daemon) Ready() bool {
+	return d.ready.Load()
+}
+
 // crawlAndTestProxies crawls new proxies and tests them
 func (d *Daemon) crawlAndTestProxies() error {
 	start := time.Now()
@@ -145,13 +399,30 @@ func (d *Daemon) crawlAndTestProxies() error {
 		return fmt.Errorf("error crawling proxies: %v", err)
 	}
 
+	d.lastCrawlTime = start
 	d.logger.Info("Crawled %d proxies in %v", len(proxies), time.Since(start))
 
+	// Remember the protocol each proxy was listed under
+	for _, proxy := range proxies {
+		if proxyType := d.crawler.TypeOf(proxy); proxyType != "" {
+			d.types[proxy] = proxyType
+		}
+	}
+
 	// Save all proxies
 	if err := d.crawler.SaveToFile(proxies, d.config.Files.AllProxies); err != nil {
 		d.logger.Info("Warning: Could not save all proxies: %v", err)
 	}
 
+	// Skip proxies whose lifecycle says they are not due for a test
+	proxies = d.skipNotDue(proxies)
+
+	// Drop candidates that do not even accept a connection before the
+	// expensive target checks
+	if d.prefilter != nil {
+		proxies = d.prefilterProxies(proxies)
+	}
+
 	// Test proxies - use all if sample size is -1 or 0, otherwise use sample
 	var testSample []string
 	sampleSize := d.config.Proxy.TestSampleSize
@@ -172,17 +443,41 @@ func (d *Daemon) crawlAndTestProxies() error {
 	return d.testProxies(testSample, "crawl")
 }
 
-// testExistingProxies tests the current working proxies
+// prefilterProxies runs the TCP/handshake prefilter and returns the survivors
+func (d *Daemon) prefilterProxies(proxies []string) []string {
+	start := time.Now()
+	d.logger.Info("🧹 Prefiltering %d candidates (TCP + handshake)...", len(proxies))
+
+	prefilterCtx, cancel := context.WithTimeout(d.ctx, 10*time.Minute)
+	defer cancel()
+	prefilterCtx = crawler.WithProxyTypes(prefilterCtx, d.typesOf(proxies))
+
+	survivors := d.prefilter.Filter(prefilterCtx, proxies)
+
+	d.logger.Info("🧹 Stage prefilter: %d → %d candidates (removed %d) in %v",
+		len(proxies), len(survivors), len(proxies)-len(survivors), time.Since(start))
+
+	return survivors
+}
+
+// testExistingProxies tests the current working proxies of all profiles
 func (d *Daemon) testExistingProxies() error {
-	if len(d.workingProxies) == 0 {
+	workingProxies := d.GetWorkingProxies()
+	if len(workingProxies) == 0 {
 		d.logger.Info("No working proxies to test, performing crawl...")
 		return d.crawlAndTestProxies()
 	}
 
-	return d.testProxies(d.workingProxies, "maintenance")
+	if pulled := d.manager.Count() - d.manager.WorkingCount(); pulled > 0 {
+		d.logger.Info("🚫 %d proxies were pulled after repeated consumer failures, retesting them", pulled)
+	}
+
+	// Retest suspect and quarantined proxies that are due along with them
+	return d.testProxies(append(workingProxies, d.dueRetests(time.Now())...), "maintenance")
 }
 
-// testProxies tests a list of proxies against ElevenLabs API
+// testProxies tests a list of proxies with every check the profiles need
+// and updates the working set of each profile
 func (d *Daemon) testProxies(proxies []string, testType string) error {
 	if len(proxies) == 0 {
 		return nil
@@ -194,90 +489,224 @@ func (d *Daemon) testProxies(proxies []string, testType string) error {
 	// Show progress for large batches
 	if len(proxies) > 1000 {
 		d.logger.Info("⏳ This is a large batch - testing %d proxies may take %d+ minutes...", 
-			len(proxies), len(proxies)/(d.config.Daemon.Threads*3)) // Rough estimate: 3 proxies per second per thread
+			len(proxies), len(proxies)*len(d.checkOrder)/(d.config.Daemon.Threads*3)) // Rough estimate: 3 proxies per second per thread
 	}
 
 	// Test proxies
 	testCtx, cancel := context.WithTimeout(d.ctx, 10*time.Minute)
 	defer cancel()
+	testCtx = crawler.WithProxyTypes(testCtx, d.typesOf(proxies))
 
-	results := d.tester.TestProxies(testCtx, proxies, d.config.Daemon.Threads)
-	
-	// Process results and save working proxies immediately in batches
-	var workingProxies []string
-	var batchResults []storage.ProxyTestResult
-	batchSize := 10 // Save every 10 working proxies
-	
-	successCount := 0
-	for i, result := range results {
-		if result.IsWorking {
-			successCount++
-			workingProxies = append(workingProxies, result.Proxy)
-			d.logger.Info("✅ WORKING: %s (latency: %dms)", result.Proxy, result.Latency.Milliseconds())
-			
-			// Prepare for MongoDB storage
-			if d.mongoStorage != nil {
-				parts := strings.Split(result.Proxy, ":")
-				ip := parts[0]
-				port := ""
-				if len(parts) > 1 {
-					port = parts[1]
-				}
-				
-				storageResult := storage.ProxyTestResult{
-					Address:   result.Proxy,
-					IP:        ip,
-					Port:      port,
-					Type:      "http",
-					IsWorking: result.IsWorking,
-					Latency:   result.Latency,
-					Error:     result.Error,
-				}
-				batchResults = append(batchResults, storageResult)
-				
-				// Save batch when we have enough working proxies OR at the end
-				if len(batchResults) >= batchSize || i == len(results)-1 {
-					if len(batchResults) > 0 {
-						d.logger.Info("💾 Saving batch of %d working proxies to MongoDB...", len(batchResults))
-						if err := d.mongoStorage.SaveWorkingProxies(testCtx, batchResults); err != nil {
-							d.logger.Error("Failed to save batch to MongoDB: %v", err)
-						} else {
-							d.logger.Info("✅ Saved batch of %d working proxies to MongoDB", len(batchResults))
-						}
-						batchResults = nil // Reset batch
-					}
+	// Run every check and collect the results by proxy and check name
+	matrix := make(map[string]map[string]crawler.CheckResult, len(proxies))
+	var failedResults []crawler.CheckResult
+	for _, name := range d.checkOrder {
+		results, err := d.runCheck(testCtx, name, proxies, testType)
+		if err != nil {
+			d.logger.Alert("🚨 %v. Keeping %d working proxies, check the API key and quota",
+				err, len(d.GetWorkingProxies()))
+			d.recordCycle(testType, start, crawler.ComputeStats(nil), err)
+			return err
+		}
+
+		passed := 0
+		for _, result := range results {
+			if matrix[result.Proxy] == nil {
+				matrix[result.Proxy] = make(map[string]crawler.CheckResult)
+			}
+			matrix[result.Proxy][name] = result
+
+			if result.IsWorking {
+				passed++
+			} else {
+				failedResults = append(failedResults, result)
+				errorMsg := "unknown error"
+				if result.Error != nil {
+					errorMsg = result.Error.Error()
 				}
+				d.logger.Debug("❌ FAILED %s: %s [%s] (error: %s)", name, result.Proxy, result.ErrorClass, errorMsg)
+			}
+		}
+
+		d.logger.Info("🎯 Stage check %s: %d → %d candidates (removed %d)",
+			name, len(results), passed, len(results)-passed)
+	}
+
+	// Count failures by class for the cycle stats
+	if len(failedResults) > 0 {
+		d.logger.Info("❌ Failures by class: %s", crawler.CountErrorClasses(failedResults))
+	}
+
+	// Work out which profiles each proxy passes and update its score
+	now := time.Now()
+	proxyProfiles := make(map[string][]string)
+	scores := make(map[string]float64, len(matrix))
+	cycle := make([]crawler.ProxyInfo, 0, len(matrix))
+	var workingResults []crawler.CheckResult
+	var failedProxies []crawler.CheckResult
+	for _, proxy := range proxies {
+		checks, ok := matrix[proxy]
+		if !ok {
+			continue // Not tested before the cycle timed out
+		}
+
+		for _, profile := range d.profiles {
+			if passesProfile(checks, profile) {
+				proxyProfiles[proxy] = append(proxyProfiles[proxy], profile.Name)
 			}
+		}
+
+		result := d.primaryResult(checks)
+		for _, check := range checks {
+			if result.ExitIP == "" {
+				result.ExitIP = check.ExitIP
+			}
+		}
+
+		// A test cut short by shutdown or the cycle timeout says nothing
+		// about the proxy. Leave it untested so a kept proxy stays kept.
+		working := len(proxyProfiles[proxy]) > 0
+		if !working && canceled(checks) {
+			delete(matrix, proxy)
+			continue
+		}
+
+		history := d.proxyHistory(proxy)
+		d.scorer.Observe(&history, working, result.Latency, result.ErrorClass, now)
+		d.history[proxy] = history
+		scores[proxy] = d.scorer.Score(history, now)
+		d.observeState(proxy, working, now)
+		cycle = append(cycle, d.cycleInfo(result, checks, working))
+
+		if working {
+			workingResults = append(workingResults, result)
+			d.logger.Info("✅ WORKING: %s (latency: %dms, score: %.2f, profiles: %s)", proxy,
+				result.Latency.Milliseconds(), scores[proxy], strings.Join(proxyProfiles[proxy], ", "))
 		} else {
-			errorMsg := "unknown error"
-			if result.Error != nil {
-				errorMsg = result.Error.Error()
+			failedProxies = append(failedProxies, result)
+		}
+	}
+
+	// Measure throughput of the proxies that passed a profile
+	var throughput map[string]float64
+	if d.throughputTester != nil && len(workingResults) > 0 {
+		workingResults, throughput = d.measureThroughput(testCtx, workingResults)
+		for proxy, rate := range throughput {
+			history := d.history[proxy]
+			d.scorer.ObserveThroughput(&history, rate)
+			d.history[proxy] = history
+			scores[proxy] = d.scorer.Score(history, now)
+		}
+	}
+
+	// Find out where the remaining proxies egress from
+	if len(workingResults) > 0 {
+		d.detectExitIPs(testCtx, workingResults)
+	}
+
+	// Check which extra targets the remaining proxies reach
+	if len(d.targetOrder) > 0 && len(workingResults) > 0 {
+		d.runTargets(testCtx, workingResults, matrix, testType)
+	}
+
+	// Group the remaining proxies by profile
+	profileProxies := make(map[string][]string)
+	for _, result := range workingResults {
+		for _, profile := range proxyProfiles[result.Proxy] {
+			profileProxies[profile] = append(profileProxies[profile], result.Proxy)
+		}
+	}
+
+	// Save results to MongoDB. Failures of proxies that were kept or are
+	// being retested are stored too, so their lifecycle state survives a
+	// restart. Failed crawl candidates are not worth a write.
+	if d.mongoStorage != nil {
+		d.saveResults(workingResults, failedProxies, throughput, proxyProfiles, matrix)
+	}
+
+	// Update the working set of every profile. Kept proxies that were not
+	// part of this test stay candidates for the set.
+	for _, profile := range d.profiles {
+		workingProxies := profileProxies[profile.Name]
+		for _, proxy := range d.workingSets[profile.Name] {
+			if _, tested := matrix[proxy]; !tested && d.states[proxy].State != crawler.StateSuspect {
+				workingProxies = append(workingProxies, proxy)
+				scores[proxy] = d.scorer.Score(d.proxyHistory(proxy), now)
 			}
-			d.logger.Debug("❌ FAILED: %s (error: %s)", result.Proxy, errorMsg)
+		}
+
+		// Best scores first
+		crawler.RankByScore(workingProxies, scores)
+
+		// Keep the best set that meets the diversity rules
+		workingProxies = d.selectDiverse(profile, workingProxies)
+
+		d.workingSets[profile.Name] = workingProxies
+		d.logger.Info("📦 Profile %s: %d passed, keeping %d from %d exit IPs",
+			profile.Name, len(profileProxies[profile.Name]), len(workingProxies),
+			crawler.CountExitIPs(workingProxies, d.exitIPs))
+	}
+
+	// Forget exit IPs of proxies that are no longer kept
+	kept := make(map[string]bool)
+	for _, proxy := range d.GetWorkingProxies() {
+		kept[proxy] = true
+	}
+	for proxy := range d.exitIPs {
+		if !kept[proxy] {
+			delete(d.exitIPs, proxy)
+		}
+	}
+
+	// Forget the history of dropped proxies once it has mostly decayed
+	retention := d.scorer.Params().SuccessHalfLife
+	for proxy, history := range d.history {
+		if !kept[proxy] && now.Sub(history.LastTested) > retention {
+			delete(d.history, proxy)
+		}
+	}
+
+	// Forget the state of proxies that have been due for a long time, they
+	// are no longer crawled
+	for proxy, status := range d.states {
+		if !kept[proxy] && now.Sub(status.NextTest) > retention {
+			delete(d.states, proxy)
 		}
 	}
-	
-	// Sort working proxies by performance
-	sort.Strings(workingProxies)
 
-	// Keep only the best proxies
-	if len(workingProxies) > d.config.Proxy.KeepWorkingProxies {
-		workingProxies = workingProxies[:d.config.Proxy.KeepWorkingProxies]
+	// Forget the type of proxies that are neither kept nor tracked
+	for proxy := range d.types {
+		if _, tracked := d.states[proxy]; !kept[proxy] && !tracked {
+			delete(d.types, proxy)
+		}
 	}
 
-	// Update working proxies in memory
-	d.workingProxies = workingProxies
+	// Publish the kept proxies with their latest results
+	tested := make(map[string]crawler.CheckResult, len(workingResults))
+	for _, result := range workingResults {
+		tested[result.Proxy] = result
+	}
+	d.syncManager(tested, throughput, matrix)
 
 	// Save working proxies to file
 	if err := d.saveWorkingProxies(); err != nil {
 		d.logger.Error("Could not save working proxies to file: %v", err)
 	}
+	if err := d.saveSnapshot(); err != nil {
+		d.logger.Error("Could not save snapshot: %v", err)
+	}
 
-	successRate := float64(successCount) / float64(len(results)) * 100
-	d.logger.Info("📊 Test completed in %v. Working: %d/%d (%.2f%%)", 
-		time.Since(start), successCount, len(results), successRate)
+	d.lastCycle = crawler.ComputeStats(cycle)
+	d.recordCycle(testType, start, d.lastCycle, nil)
+	d.logger.Info("📊 Test completed in %v: %s", time.Since(start), d.lastCycle)
+	d.logger.Info("📊 Pool: %s", d.manager.GetStats())
+
+	if d.config.Daemon.AdaptiveConcurrency {
+		d.logger.Info("⚙️ Concurrency adjusted to %d threads", d.runner.Concurrency())
+	}
 
 	// Log sample of working proxies
+	workingProxies := d.GetWorkingProxies()
 	sampleSize := 5
 	if len(workingProxies) < sampleSize {
 		sampleSize = len(workingProxies)
@@ -293,10 +722,457 @@ func (d *Daemon) testProxies(proxies []string, testType string) error {
 	return nil
 }
 
-// convertToStorageResults converts API test results to storage format
-func (d *Daemon) convertToStorageResults(apiResults []api.TestResult) []storage.ProxyTestResult {
+// canceled reports whether any check of a proxy was cut short
+func canceled(checks map[string]crawler.CheckResult) bool {
+	for _, result := range checks {
+		if result.ErrorClass == crawler.ClassCanceled {
+			return true
+		}
+	}
+	return false
+}
+
+// saveResults writes the results of a cycle to MongoDB in large batches.
+// It uses its own deadline so results of a cycle that ran into its
+// timeout are still saved.
+func (d *Daemon) saveResults(working, failed []crawler.CheckResult, throughput map[string]float64,
+	proxyProfiles map[string][]string, matrix map[string]map[string]crawler.CheckResult) {
+	kept := make(map[string]bool)
+	for _, proxy := range d.GetWorkingProxies() {
+		kept[proxy] = true
+	}
+
+	var tracked []crawler.CheckResult
+	for _, result := range failed {
+		switch d.states[result.Proxy].State {
+		case crawler.StateSuspect, crawler.StateQuarantined:
+			tracked = append(tracked, result)
+		default:
+			if kept[result.Proxy] {
+				tracked = append(tracked, result)
+			}
+		}
+	}
+
+	results := d.convertToStorageResults(working, throughput, proxyProfiles, matrix)
+	results = append(results, d.convertToStorageResults(tracked, nil, nil, matrix)...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const batchSize = 500
+	saved := 0
+	for i := 0; i < len(results); i += batchSize {
+		batch := results[i:min(i+batchSize, len(results))]
+		if err := d.mongoStorage.SaveWorkingProxies(ctx, batch); err != nil {
+			d.logger.Error("Failed to save %d proxy results to MongoDB: %v", len(batch), err)
+			continue
+		}
+		saved += len(batch)
+	}
+	d.logger.Info("💾 Saved %d/%d proxy results to MongoDB (%d working, %d failed)",
+		saved, len(results), len(working), len(tracked))
+}
+
+// runCheck runs one check on proxies. Crawled candidates go through the
+// stability sampler when it is enabled. An error means the target rejected
+// our account and the cycle's results for this check are unusable.
+func (d *Daemon) runCheck(ctx context.Context, name string, proxies []string, testType string) ([]crawler.CheckResult, error) {
+	checker := d.checkers[name]
+	if stable, ok := d.stableCheckers[name]; ok && testType == "crawl" {
+		checker = stable
+	}
+	if cycleChecker, ok := checker.(crawler.CycleChecker); ok {
+		cycleChecker.BeginCycle()
+	}
+
+	results, err := d.runner.Run(ctx, checker, proxies)
+
+	// Track quota spent on the target, e.g. ElevenLabs characters
+	if reporter, ok := checker.(crawler.UsageReporter); ok {
+		used := reporter.TakeUsage()
+		d.lastUsage[name] = used
+		d.totalUsage[name] += used
+		if used > 0 {
+			d.logger.Info("🔤 Check %s used %d quota units this cycle (%d total)",
+				name, used, d.totalUsage[name])
+		}
+	}
+
+	if err != nil {
+		// The target rejected our account, the proxies are not to blame
+		d.lastAlert = err.Error()
+		d.lastAlertTime = time.Now()
+		return nil, err
+	}
+	return results, nil
+}
+
+// runTargets runs the reachability targets on the proxies that passed a
+// profile and adds the results to the matrix. Targets do not decide which
+// proxies are kept, so a rejected target is skipped rather than failing
+// the cycle.
+func (d *Daemon) runTargets(ctx context.Context, results []crawler.CheckResult, matrix map[string]map[string]crawler.CheckResult, testType string) {
+	addresses := make([]string, len(results))
+	for i, result := range results {
+		addresses[i] = result.Proxy
+	}
+
+	for _, name := range d.targetOrder {
+		targetResults, err := d.runCheck(ctx, name, addresses, testType)
+		if err != nil {
+			d.logger.Alert("🚨 %v. Skipping target %s this cycle", err, name)
+			continue
+		}
+
+		reachable := 0
+		for _, result := range targetResults {
+			matrix[result.Proxy][name] = result
+			if result.IsWorking {
+				reachable++
+			}
+		}
+		d.logger.Info("🎯 Target %s: reachable through %d/%d proxies",
+			name, reachable, len(targetResults))
+	}
+}
+
+// targetResults converts a proxy's check results to its reachability matrix
+func targetResults(checks map[string]crawler.CheckResult) map[string]crawler.TargetResult {
+	targets := make(map[string]crawler.TargetResult, len(checks))
+	for name, result := range checks {
+		targets[name] = crawler.NewTargetResult(result)
+	}
+	return targets
+}
+
+// syncManager makes the proxy manager hold exactly the kept proxies of all
+// profiles. Proxies in results are stored with their latest results, the
+// others only get their profiles updated.
+func (d *Daemon) syncManager(results map[string]crawler.CheckResult, throughput map[string]float64, matrix map[string]map[string]crawler.CheckResult) {
+	profiles := make(map[string][]string)
+	for _, profile := range d.profiles {
+		for _, proxy := range d.workingSets[profile.Name] {
+			profiles[proxy] = append(profiles[proxy], profile.Name)
+		}
+	}
+
+	now := time.Now()
+	for proxy, names := range profiles {
+		result, ok := results[proxy]
+		if !ok {
+			updated := d.manager.Update(proxy, func(info *crawler.ProxyInfo) {
+				info.Profiles = names
+			})
+			if !updated {
+				d.manager.Upsert(crawler.ProxyInfo{
+					Address:   proxy,
+					Type:      d.proxyType(proxy),
+					IsWorking: true,
+					Profiles:  names,
+					ExitIP:    d.exitIPs[proxy],
+					Source:    d.sourceOf(proxy),
+				})
+			}
+			continue
+		}
+
+		history := d.history[proxy]
+		d.manager.Upsert(crawler.ProxyInfo{
+			Address:    proxy,
+			Type:       d.proxyType(proxy),
+			Latency:    result.Latency,
+			Throughput: throughput[proxy],
+			LastCheck:  now,
+			IsWorking:  true,
+			Profiles:   names,
+			ExitIP:     d.exitIPs[proxy],
+			Targets:    targetResults(matrix[proxy]),
+			Score:      d.scorer.Score(history, now),
+			History:    history,
+			Source:     d.sourceOf(proxy),
+		})
+	}
+
+	for _, proxy := range d.manager.ExportAddresses() {
+		if _, ok := profiles[proxy]; !ok {
+			d.manager.Remove(proxy)
+		}
+	}
+
+	if d.geoip != nil {
+		d.manager.Enrich(d.geoip)
+	}
+}
+
+// observeState moves a tested proxy through its lifecycle
+func (d *Daemon) observeState(proxy string, working bool, now time.Time) {
+	status := d.states[proxy]
+	previous := status.State
+	d.lifecycle.Observe(&status, working, now)
+	d.states[proxy] = status
+
+	if previous != status.State && previous != "" && previous != crawler.StateCandidate {
+		d.logger.Info("🔁 %s: %s → %s (next test in %v)", proxy, previous, status.State,
+			status.NextTest.Sub(now).Round(time.Second))
+	}
+}
+
+// dueRetests returns the suspect and quarantined proxies due for a retest.
+// Dead proxies are only retested when they are crawled again.
+func (d *Daemon) dueRetests(now time.Time) []string {
+	var due []string
+	for proxy, status := range d.states {
+		switch status.State {
+		case crawler.StateSuspect, crawler.StateQuarantined:
+			if status.Due(now) {
+				due = append(due, proxy)
+			}
+		}
+	}
+	sort.Strings(due)
+	return due
+}
+
+// skipNotDue drops crawled proxies that are already working or are
+// quarantined or dead and not yet due for a retest
+func (d *Daemon) skipNotDue(proxies []string) []string {
+	now := time.Now()
+	kept := make(map[string]bool)
+	for _, proxy := range d.GetWorkingProxies() {
+		kept[proxy] = true
+	}
+
+	due := make([]string, 0, len(proxies))
+	for _, proxy := range proxies {
+		status, known := d.states[proxy]
+		if kept[proxy] || (known && !status.Due(now)) {
+			continue
+		}
+		due = append(due, proxy)
+	}
+
+	if skipped := len(proxies) - len(due); skipped > 0 {
+		d.logger.Info("⏭️ Skipping %d crawled proxies that are working or not due for a retest", skipped)
+	}
+	return due
+}
+
+// loadStates restores the lifecycle states saved in MongoDB
+func (d *Daemon) loadStates() error {
+	if d.mongoStorage == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	records, err := d.mongoStorage.LoadStates(ctx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		d.states[record.Address] = crawler.ProxyStatus{
+			State:    crawler.ProxyState(record.State),
+			Since:    record.StateSince,
+			Failures: record.ConsecutiveFailures,
+			NextTest: record.NextTest,
+		}
+		if record.Type != "" {
+			d.types[record.Address] = crawler.ProxyType(record.Type)
+		}
+	}
+	d.logger.Info("Loaded the lifecycle state of %d proxies from MongoDB", len(records))
+	return nil
+}
+
+// proxyType returns the protocol a proxy was listed under, HTTP when it
+// is not known
+func (d *Daemon) proxyType(proxy string) crawler.ProxyType {
+	if proxyType, ok := d.types[proxy]; ok {
+		return proxyType
+	}
+	return crawler.HTTP
+}
+
+// typesOf returns the protocols of proxies for crawler.WithProxyTypes. The
+// checks read the copy while the cycle may update the daemon's map.
+func (d *Daemon) typesOf(proxies []string) map[string]crawler.ProxyType {
+	types := make(map[string]crawler.ProxyType, len(proxies))
+	for _, proxy := range proxies {
+		types[proxy] = d.proxyType(proxy)
+	}
+	return types
+}
+
+// proxyHistory returns the scoring history of a proxy. Kept proxies take
+// it from the manager, which includes feedback from consumers.
+func (d *Daemon) proxyHistory(proxy string) crawler.ProxyHistory {
+	if info, ok := d.manager.Get(proxy); ok {
+		return info.History
+	}
+	return d.history[proxy]
+}
+
+// Manager returns the manager holding the kept proxies. It is safe to
+// query while the daemon runs.
+func (d *Daemon) Manager() *crawler.ProxyManager {
+	return d.manager
+}
+
+// selectDiverse picks the kept set of a profile from proxies ranked best
+// first, so that it meets the diversity rules
+func (d *Daemon) selectDiverse(profile config.ProfileConfig, ranked []string) []string {
+	candidates := make([]crawler.ProxyInfo, len(ranked))
+	for i, proxy := range ranked {
+		candidate := crawler.ProxyInfo{
+			Address: proxy,
+			IP:      strings.Split(proxy, ":")[0],
+			Type:    d.proxyType(proxy),
+			ExitIP:  d.exitIPs[proxy],
+		}
+		if d.geoip != nil {
+			geo := d.geoip.LookupString(candidate.IP)
+			candidate.Country, candidate.ASN = geo.Country, geo.ASN
+		}
+		candidates[i] = candidate
+	}
+
+	selected, shortfall := crawler.SelectDiverse(candidates, profile.KeepWorkingProxies, d.diversity)
+	for proxyType, missing := range shortfall {
+		d.logger.Warn("Profile %s: %d %s proxies short of the minimum share", profile.Name, missing, proxyType)
+	}
+
+	kept := make([]string, len(selected))
+	for i, proxy := range selected {
+		kept[i] = proxy.Address
+	}
+	return kept
+}
+
+// passesProfile reports whether a proxy passed every check of a profile
+func passesProfile(checks map[string]crawler.CheckResult, profile config.ProfileConfig) bool {
+	for _, name := range profile.Checks {
+		if result, ok := checks[name]; !ok || !result.IsWorking {
+			return false
+		}
+	}
+	return true
+}
+
+// primaryResult picks the result that represents a proxy in logs and
+// storage: the first passed check in check order, or the first failure
+func (d *Daemon) primaryResult(checks map[string]crawler.CheckResult) crawler.CheckResult {
+	var failed *crawler.CheckResult
+	for _, name := range d.checkOrder {
+		result, ok := checks[name]
+		if !ok {
+			continue
+		}
+		if result.IsWorking {
+			return result
+		}
+		if failed == nil {
+			failed = &result
+		}
+	}
+	return *failed
+}
+
+// detectExitIPs records the exit IP of every result, asking the judge for
+// the ones no check has reported
+func (d *Daemon) detectExitIPs(ctx context.Context, results []crawler.CheckResult) {
+	var unknown []string
+	for _, result := range results {
+		if result.ExitIP != "" {
+			d.exitIPs[result.Proxy] = result.ExitIP
+		} else {
+			unknown = append(unknown, result.Proxy)
+		}
+	}
+
+	if d.exitIPDetector != nil && len(unknown) > 0 {
+		for proxy, ip := range d.exitIPDetector.DetectAll(ctx, unknown) {
+			d.exitIPs[proxy] = ip
+		}
+	}
+
+	for i := range results {
+		if results[i].ExitIP == "" {
+			results[i].ExitIP = d.exitIPs[results[i].Proxy]
+		}
+	}
+
+	addresses := make([]string, len(results))
+	for i, result := range results {
+		addresses[i] = result.Proxy
+	}
+	d.logger.Info("🌐 Stage exit IP: %d proxies egress from %d distinct IPs",
+		len(results), crawler.CountExitIPs(addresses, d.exitIPs))
+}
+
+// lookupGeo returns the GeoIP data of an address, or nil if the databases
+// know nothing about it
+func (d *Daemon) lookupGeo(address string) *storage.GeoInfo {
+	info := d.geoip.LookupString(address)
+	if info.IsZero() {
+		return nil
+	}
+	return &storage.GeoInfo{
+		Country: info.Country,
+		City:    info.City,
+		ASN:     info.ASN,
+		Org:     info.Org,
+	}
+}
+
+// measureThroughput runs the throughput test on working proxies and returns
+// the proxies that meet the configured minimum rate along with the measured
+// rates by address
+func (d *Daemon) measureThroughput(ctx context.Context, results []crawler.CheckResult) ([]crawler.CheckResult, map[string]float64) {
+	addresses := make([]string, len(results))
+	for i, result := range results {
+		addresses[i] = result.Proxy
+	}
+
+	d.logger.Info("📶 Measuring throughput of %d working proxies...", len(addresses))
+	throughputResults := d.throughputTester.TestProxies(ctx, addresses, d.config.Daemon.Threads)
+
+	throughput := make(map[string]float64, len(throughputResults))
+	for _, tr := range throughputResults {
+		if tr.Error != nil {
+			d.logger.Debug("📶 %s: throughput test failed: %v", tr.Proxy, tr.Error)
+			continue
+		}
+		throughput[tr.Proxy] = tr.BytesPerSecond
+		d.logger.Info("📶 %s: %s (%d bytes in %v)", tr.Proxy,
+			crawler.FormatBytesPerSecond(tr.BytesPerSecond), tr.Bytes, tr.Duration)
+	}
+
+	minRate := float64(d.config.Throughput.MinBytesPerSecond)
+	if minRate <= 0 {
+		return results, throughput
+	}
+
+	// Drop proxies that are too slow or could not complete the download
+	var fast []crawler.CheckResult
+	for _, result := range results {
+		if throughput[result.Proxy] >= minRate {
+			fast = append(fast, result)
+		}
+	}
+	d.logger.Info("📶 %d/%d proxies meet the minimum throughput of %s",
+		len(fast), len(results), crawler.FormatBytesPerSecond(minRate))
+
+	return fast, throughput
+}
+
+// convertToStorageResults converts check results to storage format, with
+// the reachability matrix of each proxy taken from matrix
+func (d *Daemon) convertToStorageResults(apiResults []crawler.CheckResult, throughput map[string]float64, profiles map[string][]string, matrix map[string]map[string]crawler.CheckResult) []storage.ProxyTestResult {
 	storageResults := make([]storage.ProxyTestResult, len(apiResults))
-	
+	now := time.Now()
+
 	for i, apiResult := range apiResults {
 		parts := strings.Split(apiResult.Proxy, ":")
 		ip := apiResult.Proxy
@@ -305,91 +1181,174 @@ func (d *Daemon) convertToStorageResults(apiResults []api.TestResult) []storage.
 			ip = parts[0]
 			port = parts[1]
 		}
-		
+
 		storageResults[i] = storage.ProxyTestResult{
-			Address:   apiResult.Proxy,
-			IP:        ip,
-			Port:      port,
-			Type:      "http", // Default to HTTP, could be enhanced to detect type
-			IsWorking: apiResult.IsWorking,
-			Latency:   apiResult.Latency,
-			Error:     apiResult.Error,
+			Address:        apiResult.Proxy,
+			IP:             ip,
+			Port:           port,
+			Type:           string(d.proxyType(apiResult.Proxy)),
+			IsWorking:      apiResult.IsWorking,
+			Latency:        apiResult.Latency,
+			BytesPerSecond: throughput[apiResult.Proxy],
+			Error:          apiResult.Error,
+			ErrorClass:     string(apiResult.ErrorClass),
+			Profiles:       profiles[apiResult.Proxy],
+			ExitIP:         apiResult.ExitIP,
+		}
+
+		if history, ok := d.history[apiResult.Proxy]; ok {
+			storageResults[i].Score = d.scorer.Score(history, now)
+			storageResults[i].LatencyEWMA = history.LatencyEWMA
+		}
+
+		if status, ok := d.states[apiResult.Proxy]; ok {
+			storageResults[i].State = &storage.StateRecord{
+				Address:             apiResult.Proxy,
+				State:               string(status.State),
+				StateSince:          status.Since,
+				ConsecutiveFailures: status.Failures,
+				NextTest:            status.NextTest,
+			}
+		}
+
+		if d.geoip != nil {
+			storageResults[i].Geo = d.lookupGeo(ip)
+			if apiResult.ExitIP != "" {
+				storageResults[i].ExitGeo = d.lookupGeo(apiResult.ExitIP)
+			}
+		}
+
+		if checks := matrix[apiResult.Proxy]; len(checks) > 0 {
+			targets := make(map[string]storage.TargetStatus, len(checks))
+			for name, check := range checks {
+				targets[name] = storage.TargetStatus{
+					Reachable:  check.IsWorking,
+					StatusCode: check.StatusCode,
+					LatencyMs:  check.Latency.Milliseconds(),
+					ErrorClass: string(check.ErrorClass),
+				}
+			}
+			storageResults[i].Targets = targets
+		}
+
+		if stats := apiResult.Stability; stats != nil {
+			storageResults[i].Samples = stats.Samples
+			storageResults[i].SampleSuccessRatio = stats.SuccessRatio
+			storageResults[i].P95Latency = stats.P95Latency
+			storageResults[i].Jitter = stats.Jitter
 		}
 	}
-	
+
 	return storageResults
 }
 
-// saveWorkingProxies saves working proxies to file
+// saveWorkingProxies saves the working proxies of every profile to its file
 func (d *Daemon) saveWorkingProxies() error {
-	return d.crawler.SaveToFile(d.workingProxies, d.config.Files.WorkingProxies)
+	for _, profile := range d.profiles {
+		if err := d.crawler.SaveToFile(d.workingSets[profile.Name], profile.WorkingProxies); err != nil {
+			return fmt.Errorf("profile %s: %v", profile.Name, err)
+		}
+	}
+	return nil
 }
 
-// loadWorkingProxies loads working proxies from file
+// loadWorkingProxies loads the working proxies of every profile
 func (d *Daemon) loadWorkingProxies() error {
+	var errs []string
+	for _, profile := range d.profiles {
+		if err := d.loadProfileProxies(profile); err != nil {
+			errs = append(errs, fmt.Sprintf("profile %s: %v", profile.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// loadProfileProxies loads the working proxies of a profile from MongoDB,
+// falling back to the profile's file
+func (d *Daemon) loadProfileProxies(profile config.ProfileConfig) error {
 	// Try to load from MongoDB first if enabled
 	if d.mongoStorage != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
-		
-		mongoProxies, err := d.mongoStorage.GetWorkingProxies(ctx, d.config.Proxy.KeepWorkingProxies)
+
+		var mongoProxies []string
+		var err error
+		if len(d.config.Profiles) == 0 {
+			// Documents written before profiles existed have none
+			mongoProxies, err = d.mongoStorage.GetWorkingProxies(ctx, profile.KeepWorkingProxies)
+		} else {
+			mongoProxies, err = d.mongoStorage.GetWorkingProxiesForProfile(ctx, profile.Name, profile.KeepWorkingProxies)
+		}
+
 		if err != nil {
 			d.logger.Info("Warning: Could not load proxies from MongoDB: %v", err)
 		} else if len(mongoProxies) > 0 {
-			d.workingProxies = mongoProxies
-			d.logger.Info("Loaded %d working proxies from MongoDB", len(mongoProxies))
+			d.workingSets[profile.Name] = mongoProxies
+			d.logger.Info("Loaded %d working proxies for profile %s from MongoDB", len(mongoProxies), profile.Name)
 			return nil
 		}
 	}
 
 	// Fallback to file
-	proxies, err := d.crawler.LoadFromFile(d.config.Files.WorkingProxies)
+	proxies, err := d.crawler.LoadFromFile(profile.WorkingProxies)
 	if err != nil {
 		return err
 	}
-	d.workingProxies = proxies
-	d.logger.Info("Loaded %d working proxies from file", len(proxies))
+	d.workingSets[profile.Name] = proxies
+	d.logger.Info("Loaded %d working proxies for profile %s from file", len(proxies), profile.Name)
 	return nil
 }
 
-// GetWorkingProxies returns the current list of working proxies
+// GetWorkingProxies returns the working proxies of all profiles
 func (d *Daemon) GetWorkingProxies() []string {
-	return d.workingProxies
-}
-
-// GetStats returns daemon statistics
-func (d *Daemon) GetStats() map[string]interface{} {
-	stats := map[string]interface{}{
-		"working_proxies": len(d.workingProxies),
-		"last_crawl":      d.lastCrawlTime,
-		"uptime":          time.Since(d.lastCrawlTime),
-		"mongodb_enabled": d.mongoStorage != nil,
-	}
-
-	// Add MongoDB stats if available
-	if d.mongoStorage != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		
-		mongoStats, err := d.mongoStorage.GetProxyStats(ctx)
-		if err != nil {
-			d.logger.Info("Warning: Could not get MongoDB stats: %v", err)
-		} else {
-			stats["mongodb_stats"] = mongoStats
+	seen := make(map[string]bool)
+	var proxies []string
+	for _, profile := range d.profiles {
+		for _, proxy := range d.workingSets[profile.Name] {
+			if !seen[proxy] {
+				seen[proxy] = true
+				proxies = append(proxies, proxy)
+			}
 		}
 	}
+	return proxies
+}
 
-	return stats
+// GetWorkingProxiesForProfile returns the working proxies that pass the
+// given profile
+func (d *Daemon) GetWorkingProxiesForProfile(profile string) []string {
+	return d.workingSets[profile]
 }
 
 // shutdown gracefully shuts down the daemon
 func (d *Daemon) shutdown() error {
 	d.logger.Info("Shutting down daemon...")
 	
+	// Stop accepting API requests
+	if d.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := d.httpServer.Shutdown(ctx); err != nil {
+			d.logger.Info("Error stopping HTTP API: %v", err)
+		}
+	}
+
+	// Wait for a running cycle, which stops early once the context is
+	// canceled
+	d.cycleMu.Lock()
+	defer d.cycleMu.Unlock()
+
 	// Save current working proxies
 	if err := d.saveWorkingProxies(); err != nil {
 		d.logger.Info("Error saving working proxies during shutdown: %v", err)
 	}
+	if err := d.saveSnapshot(); err != nil {
+		d.logger.Info("Error saving snapshot during shutdown: %v", err)
+	}
 
 	// Close MongoDB connection
 	if d.mongoStorage != nil {
@@ -0,0 +1,60 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"regproxy/config"
+	"testing"
+)
+
+// testConfig has a local check, so the daemon needs no API key
+const testConfig = `
+daemon:
+  check: "local"
+checks:
+  - name: "local"
+    url: "http://127.0.0.1:1/health"
+profiles:
+  - name: "tts"
+    checks: ["local"]
+  - name: "web"
+    checks: ["local"]
+`
+
+// newDaemon creates a daemon from testConfig that logs errors to stdout
+// only. It does not crawl or test anything.
+func newDaemon(t *testing.T) *Daemon {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Daemon.LogLevel = "error"
+	cfg.Files.LogFile = ""
+
+	d, err := NewDaemon(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.cancel)
+	return d
+}
+
+func TestNewDiversityRulesExitIP(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.ExitIP.MaxPerExitIP = 1
+
+	// Exit IPs known from earlier runs or the httpbin check do not limit
+	// the set while detection is off
+	if rules := NewDiversityRules(cfg); rules.MaxPerExitIP != 0 {
+		t.Errorf("max per exit IP %d with detection disabled", rules.MaxPerExitIP)
+	}
+	cfg.ExitIP.Enabled = true
+	if rules := NewDiversityRules(cfg); rules.MaxPerExitIP != 1 {
+		t.Errorf("max per exit IP %d with detection enabled, want 1", rules.MaxPerExitIP)
+	}
+}
@@ -0,0 +1,27 @@
+package daemon
+
+import (
+	"regproxy/config"
+	"regproxy/crawler"
+	"time"
+)
+
+// NewLifecycle creates the proxy lifecycle set up in the lifecycle section
+// of the config. Working proxies are retested every daemon.interval.
+func NewLifecycle(cfg *config.Config) *crawler.Lifecycle {
+	seconds := func(n int) time.Duration {
+		return time.Duration(n) * time.Second
+	}
+	return crawler.NewLifecycle(crawler.LifecycleParams{
+		Intervals: map[crawler.ProxyState]time.Duration{
+			crawler.StateWorking:     cfg.GetInterval(),
+			crawler.StateSuspect:     cfg.GetSuspectInterval(),
+			crawler.StateQuarantined: seconds(cfg.Lifecycle.QuarantineInterval),
+			crawler.StateDead:        seconds(cfg.Lifecycle.DeadInterval),
+		},
+		BackoffFactor:      cfg.Lifecycle.BackoffFactor,
+		MaxInterval:        seconds(cfg.Lifecycle.MaxInterval),
+		SuspectFailures:    cfg.Lifecycle.SuspectFailures,
+		QuarantineFailures: cfg.Lifecycle.QuarantineFailures,
+	})
+}
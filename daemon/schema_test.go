@@ -0,0 +1,241 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schemaChecker validates JSON documents against the schemas in
+// daemon/schemas. It supports the subset of JSON Schema they use: type,
+// required, properties, additionalProperties, propertyNames, items, enum,
+// const, minimum, maximum, format date-time and $ref to other files or $defs.
+type schemaChecker struct {
+	docs map[string]map[string]any
+}
+
+func newSchemaChecker(t *testing.T) *schemaChecker {
+	t.Helper()
+	entries, err := schemas.ReadDir("schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &schemaChecker{docs: make(map[string]map[string]any)}
+	for _, entry := range entries {
+		data, err := schemas.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: %v", entry.Name(), err)
+		}
+		c.docs[entry.Name()] = doc
+	}
+	return c
+}
+
+// check validates body against the named schema and fails the test with
+// every violation
+func (c *schemaChecker) check(t *testing.T, name string, body []byte) {
+	t.Helper()
+	if errs := c.validate(name, body); len(errs) > 0 {
+		t.Errorf("body does not match %s:\n  %s\nbody: %s", name, strings.Join(errs, "\n  "), body)
+	}
+}
+
+// validate returns the violations of body against the named schema
+func (c *schemaChecker) validate(name string, body []byte) []string {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []string{err.Error()}
+	}
+	doc, ok := c.docs[name]
+	if !ok {
+		return []string{"unknown schema " + name}
+	}
+	var errs []string
+	c.walk(name, doc, value, "$", &errs)
+	return errs
+}
+
+func (c *schemaChecker) walk(file string, schema map[string]any, value any, path string, errs *[]string) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, fragment, _ := strings.Cut(ref, "#")
+		if target != "" {
+			file = target
+		}
+		resolved, ok := c.docs[file]
+		if !ok {
+			fail("unresolved $ref %s", ref)
+			return
+		}
+		for _, part := range strings.Split(strings.Trim(fragment, "/"), "/") {
+			if part == "" {
+				continue
+			}
+			if resolved, ok = resolved[part].(map[string]any); !ok {
+				fail("unresolved $ref %s", ref)
+				return
+			}
+		}
+		c.walk(file, resolved, value, path, errs)
+		return
+	}
+
+	if want, ok := schema["type"].(string); ok && !hasType(value, want) {
+		fail("%s is not of type %s", describe(value), want)
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+			}
+		}
+		if !found {
+			fail("%s is not one of %v", describe(value), enum)
+		}
+	}
+
+	if want, ok := schema["const"]; ok && !reflect.DeepEqual(want, value) {
+		fail("%s is not %s", describe(value), describe(want))
+	}
+
+	if n, ok := value.(float64); ok {
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			fail("%v is below the minimum %v", n, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			fail("%v is above the maximum %v", n, maximum)
+		}
+	}
+
+	if s, ok := value.(string); ok && schema["format"] == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+			fail("%q is not a date-time", s)
+		}
+	}
+
+	if object, ok := value.(map[string]any); ok {
+		required, _ := schema["required"].([]any)
+		for _, key := range required {
+			if _, ok := object[key.(string)]; !ok {
+				fail("missing required %q", key)
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if names, ok := schema["propertyNames"].(map[string]any); ok {
+				c.walk(file, names, key, path+"."+key+"(name)", errs)
+			}
+			if property, ok := properties[key].(map[string]any); ok {
+				c.walk(file, property, object[key], path+"."+key, errs)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %q", key)
+				}
+			case map[string]any:
+				c.walk(file, additional, object[key], path+"."+key, errs)
+			}
+		}
+	}
+
+	if array, ok := value.([]any); ok {
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range array {
+				c.walk(file, items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	}
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type
+func hasType(value any, want string) bool {
+	switch v := value.(type) {
+	case nil:
+		return want == "null"
+	case bool:
+		return want == "boolean"
+	case string:
+		return want == "string"
+	case float64:
+		return want == "number" || (want == "integer" && v == math.Trunc(v))
+	case []any:
+		return want == "array"
+	case map[string]any:
+		return want == "object"
+	}
+	return false
+}
+
+func describe(value any) string {
+	data, _ := json.Marshal(value)
+	if len(data) > 40 {
+		return string(data[:40]) + "..."
+	}
+	return string(data)
+}
+
+func TestSchemaCheckerCatchesViolations(t *testing.T) {
+	c := newSchemaChecker(t)
+
+	tests := []struct {
+		schema string
+		body   string
+		want   string
+	}{
+		{"health.json", `{"status": "ready", "ready": true, "working_proxies": 1}`, `missing required "uptime_seconds"`},
+		{"health.json", `{"status": "up", "ready": true, "working_proxies": 1, "uptime_seconds": 0}`, "is not one of"},
+		{"health.json", `{"status": "ready", "ready": true, "working_proxies": 1.5, "uptime_seconds": 0}`, "not of type integer"},
+		{"lease_request.json", `{"strategy": "sticky", "session": "x"}`, `unexpected property "session"`},
+		{"lease.json", `{"id": "a", "expires": "soon", "proxy": {}}`, "is not a date-time"},
+		{"lease.json", `{"id": "a", "expires": "2026-01-01T00:00:00Z", "proxy": {"address": 1}}`, "$.proxy.address"},
+		{"stats.json", `{"states": {"zombie": 1}}`, "$.states.zombie(name)"},
+		{"proxy_stats.json", `{"success_rate": 101}`, "above the maximum"},
+		{"trigger.json", `{"cycle": "crawl", "status": "queued"}`, `"queued" is not "started"`},
+	}
+	for _, tt := range tests {
+		errs := strings.Join(c.validate(tt.schema, []byte(tt.body)), "\n")
+		if !strings.Contains(errs, tt.want) {
+			t.Errorf("%s %s: want a violation containing %q, got:\n%s", tt.schema, tt.body, tt.want, errs)
+		}
+	}
+}
+
+func TestSchemasResolve(t *testing.T) {
+	c := newSchemaChecker(t)
+	for name, doc := range c.docs {
+		if id, _ := doc["$id"].(string); id != "/schemas/"+name {
+			t.Errorf("%s has $id %q", name, id)
+		}
+	}
+
+	// A $ref that does not resolve fails every document it is reached from
+	var errs []string
+	c.walk("stats.json", map[string]any{"$ref": "missing.json"}, map[string]any{}, "$", &errs)
+	if len(errs) == 0 {
+		t.Fatal("unresolved $ref was not reported")
+	}
+}
@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"regproxy/config"
+	"regproxy/crawler"
+	"time"
+)
+
+// NewScorer creates the scoring model set up in the scoring section of
+// the config
+func NewScorer(cfg *config.Config) *crawler.Scorer {
+	return crawler.NewScorer(crawler.ScoreParams{
+		Weights: crawler.ScoreWeights{
+			Latency:    cfg.Scoring.LatencyWeight,
+			Success:    cfg.Scoring.SuccessWeight,
+			Uptime:     cfg.Scoring.UptimeWeight,
+			Errors:     cfg.Scoring.ErrorWeight,
+			Throughput: cfg.Scoring.ThroughputWeight,
+		},
+		LatencyAlpha:    cfg.Scoring.LatencyAlpha,
+		LatencyRef:      time.Duration(cfg.Scoring.LatencyRefMs) * time.Millisecond,
+		SuccessHalfLife: time.Duration(cfg.Scoring.SuccessHalfLife) * time.Second,
+		ErrorHalfLife:   time.Duration(cfg.Scoring.ErrorHalfLife) * time.Second,
+		UptimeHorizon:   time.Duration(cfg.Scoring.UptimeHorizon) * time.Second,
+		ThroughputRef:   float64(cfg.Scoring.ThroughputRef),
+	})
+}
+
+// NewDiversityRules returns the rules the kept set of every profile has to
+// meet, from the diversity and exit_ip sections of the config
+func NewDiversityRules(cfg *config.Config) crawler.DiversityRules {
+	rules := crawler.DiversityRules{
+		MaxPerSubnet:    cfg.Diversity.MaxPerSubnet,
+		MaxPerASN:       cfg.Diversity.MaxPerASN,
+		MaxCountryShare: cfg.Diversity.MaxCountryShare,
+	}
+	// Exit IPs restored from a snapshot go stale once detection is off
+	if cfg.ExitIP.Enabled {
+		rules.MaxPerExitIP = cfg.ExitIP.MaxPerExitIP
+	}
+	if len(cfg.Diversity.MinTypeShare) > 0 {
+		rules.MinTypeShare = make(map[crawler.ProxyType]float64, len(cfg.Diversity.MinTypeShare))
+		for proxyType, share := range cfg.Diversity.MinTypeShare {
+			rules.MinTypeShare[crawler.ProxyType(proxyType)] = share
+		}
+	}
+	return rules
+}
@@ -0,0 +1,516 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regproxy/crawler"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of GET /proxies
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// server serves the HTTP API of a daemon
+type server struct {
+	daemon     *Daemon
+	token      string
+	strategies map[string]crawler.Strategy
+}
+
+// Handler returns the HTTP API of the daemon. A non-empty token must be
+// sent as a bearer token on every request except GET /healthz.
+func (d *Daemon) Handler(token string) http.Handler {
+	s := &server{
+		daemon:     d,
+		token:      token,
+		strategies: make(map[string]crawler.Strategy, len(crawler.StrategyNames)),
+	}
+
+	// Strategies keep state such as the round-robin position, so every
+	// request shares one instance per name
+	for _, name := range crawler.StrategyNames {
+		strategy, _ := crawler.NewStrategy(name)
+		s.strategies[name] = strategy
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.health)
+	mux.HandleFunc("GET /proxies", s.listProxies)
+	mux.HandleFunc("GET /proxies/next", s.nextProxy)
+	mux.HandleFunc("POST /leases", s.createLease)
+	mux.HandleFunc("POST /leases/{id}/success", s.reportSuccess)
+	mux.HandleFunc("POST /leases/{id}/failure", s.reportFailure)
+	mux.HandleFunc("GET /stats", s.stats)
+	mux.HandleFunc("GET /cycles", s.cycles)
+	mux.HandleFunc("POST /cycles/crawl", s.triggerCrawl)
+	mux.HandleFunc("POST /cycles/test", s.triggerTest)
+	mux.HandleFunc("GET /schemas/{name}", s.schema)
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests without the bearer token
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.URL.Path != "/healthz" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// healthResponse is the body of GET /healthz
+type healthResponse struct {
+	Status         string `json:"status"`
+	Ready          bool   `json:"ready"`
+	WorkingProxies int    `json:"working_proxies"`
+	UptimeSeconds  int64  `json:"uptime_seconds"`
+}
+
+// health reports 200 once the proxies loaded on start were revalidated,
+// 503 before
+func (s *server) health(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{
+		Status:         "starting",
+		Ready:          s.daemon.Ready(),
+		WorkingProxies: s.daemon.manager.WorkingCount(),
+		UptimeSeconds:  int64(time.Since(s.daemon.startTime).Seconds()),
+	}
+
+	status := http.StatusServiceUnavailable
+	if response.Ready {
+		response.Status = "ready"
+		status = http.StatusOK
+	}
+	writeJSON(w, status, response)
+}
+
+// proxyList is the body of GET /proxies
+type proxyList struct {
+	Total   int         `json:"total"`
+	Offset  int         `json:"offset"`
+	Limit   int         `json:"limit"`
+	Proxies []proxyJSON `json:"proxies"`
+}
+
+// listProxies returns the kept proxies in insertion order, filtered by
+// type, country, profile, target, working and min_score and paginated by
+// offset and limit
+func (s *server) listProxies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, err := intParam(query.Get("offset"), 0, 0, -1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "offset: "+err.Error())
+		return
+	}
+	limit, err := intParam(query.Get("limit"), defaultPageSize, 1, maxPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "limit: "+err.Error())
+		return
+	}
+
+	var working *bool
+	if value := query.Get("working"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "working must be true or false")
+			return
+		}
+		working = &parsed
+	}
+
+	minScore := 0.0
+	if value := query.Get("min_score"); value != "" {
+		minScore, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "min_score must be a number")
+			return
+		}
+	}
+
+	var matches []crawler.ProxyInfo
+	for _, proxy := range s.daemon.manager.Query(filterParams(query)) {
+		if (working != nil && proxy.IsWorking != *working) || proxy.Score < minScore {
+			continue
+		}
+		matches = append(matches, proxy)
+	}
+
+	response := proxyList{
+		Total:   len(matches),
+		Offset:  offset,
+		Limit:   limit,
+		Proxies: []proxyJSON{},
+	}
+	if offset < len(matches) {
+		for _, proxy := range matches[offset:min(offset+limit, len(matches))] {
+			response.Proxies = append(response.Proxies, newProxyJSON(proxy))
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// filterParams reads the type, country, profile and target query
+// parameters. target is a comma-separated list.
+func filterParams(query url.Values) crawler.Filter {
+	filter := crawler.Filter{
+		Type:    crawler.ProxyType(strings.ToLower(query.Get("type"))),
+		Country: strings.ToUpper(query.Get("country")),
+		Profile: query.Get("profile"),
+	}
+	if value := query.Get("target"); value != "" {
+		filter.Targets = strings.Split(value, ",")
+	}
+	return filter
+}
+
+// nextProxy picks a working proxy with the strategy named in the query,
+// round_robin by default, among the proxies passing the type, country,
+// profile and target parameters. The pick is not leased, use POST /leases
+// to count the proxy as in flight and report back.
+func (s *server) nextProxy(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	strategy, ok := s.strategy(w, query.Get("strategy"))
+	if !ok {
+		return
+	}
+
+	proxy, err := s.daemon.manager.Select(strategy, query.Get("key"), filterParams(query))
+	if errors.Is(err, crawler.ErrNoProxies) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.daemon.manager.Release(proxy.Address)
+	proxy.InFlight--
+	writeJSON(w, http.StatusOK, newProxyJSON(proxy))
+}
+
+// leaseRequest is the body of POST /leases
+type leaseRequest struct {
+	Strategy   string   `json:"strategy"`
+	Key        string   `json:"key"`
+	TTLSeconds int      `json:"ttl_seconds"`
+	Type       string   `json:"type"`
+	Country    string   `json:"country"`
+	Profile    string   `json:"profile"`
+	Targets    []string `json:"targets"`
+}
+
+// leaseResponse is a lease handed out by POST /leases
+type leaseResponse struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+	Proxy   proxyJSON `json:"proxy"`
+}
+
+// createLease leases a working proxy passing the request's filter for
+// ttl_seconds, lease.ttl by default
+func (s *server) createLease(w http.ResponseWriter, r *http.Request) {
+	var request leaseRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+	strategy, ok := s.strategy(w, request.Strategy)
+	if !ok {
+		return
+	}
+	if request.TTLSeconds < 0 {
+		writeError(w, http.StatusBadRequest, "ttl_seconds must not be negative")
+		return
+	}
+
+	ttl := s.daemon.config.GetLeaseTTL()
+	if request.TTLSeconds > 0 {
+		ttl = time.Duration(request.TTLSeconds) * time.Second
+	}
+
+	filter := crawler.Filter{
+		Type:    crawler.ProxyType(strings.ToLower(request.Type)),
+		Country: strings.ToUpper(request.Country),
+		Profile: request.Profile,
+		Targets: request.Targets,
+	}
+	lease, err := s.daemon.manager.Lease(strategy, request.Key, filter, ttl)
+	if errors.Is(err, crawler.ErrNoProxies) {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, leaseResponse{
+		ID:      lease.ID,
+		Expires: lease.Expires,
+		Proxy:   newProxyJSON(lease.Proxy),
+	})
+}
+
+// feedbackRequest is the body of the lease feedback endpoints
+type feedbackRequest struct {
+	LatencyMs  int64  `json:"latency_ms"`
+	ErrorClass string `json:"error_class"`
+}
+
+// reportSuccess closes a lease whose proxy worked
+func (s *server) reportSuccess(w http.ResponseWriter, r *http.Request) {
+	var request feedbackRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+	latency := time.Duration(request.LatencyMs) * time.Millisecond
+	s.writeFeedback(w, s.daemon.manager.ReportSuccess(r.PathValue("id"), latency))
+}
+
+// reportFailure closes a lease whose proxy failed
+func (s *server) reportFailure(w http.ResponseWriter, r *http.Request) {
+	var request feedbackRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+	class := crawler.ErrorClass(request.ErrorClass)
+	if class == crawler.ClassNone {
+		class = crawler.ClassUnknown
+	}
+	s.writeFeedback(w, s.daemon.manager.ReportFailure(r.PathValue("id"), class))
+}
+
+func (s *server) writeFeedback(w http.ResponseWriter, err error) {
+	if errors.Is(err, crawler.ErrUnknownLease) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stats returns the daemon stats
+func (s *server) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.daemon.GetStats())
+}
+
+// cycleList is the body of GET /cycles
+type cycleList struct {
+	Cycles []CycleRecord `json:"cycles"`
+}
+
+// cycles returns the recent cycles, newest first
+func (s *server) cycles(w http.ResponseWriter, r *http.Request) {
+	records := s.daemon.GetCycles()
+	response := cycleList{Cycles: make([]CycleRecord, 0, len(records))}
+	for i := len(records) - 1; i >= 0; i-- {
+		response.Cycles = append(response.Cycles, records[i])
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// triggerCrawl starts a crawl cycle in the background
+func (s *server) triggerCrawl(w http.ResponseWriter, r *http.Request) {
+	s.trigger(w, "crawl", func() {
+		s.daemon.logger.Info("Starting proxy crawl cycle (requested over HTTP)...")
+		if err := s.daemon.crawlAndTestProxies(); err != nil {
+			s.daemon.logger.Info("Error crawling proxies: %v", err)
+		}
+	})
+}
+
+// triggerTest starts a test cycle of the kept proxies in the background
+func (s *server) triggerTest(w http.ResponseWriter, r *http.Request) {
+	s.trigger(w, "test", func() {
+		s.daemon.logger.Info("Starting proxy test cycle (requested over HTTP)...")
+		if err := s.daemon.testExistingProxies(); err != nil {
+			s.daemon.logger.Info("Error testing proxies: %v", err)
+		}
+	})
+}
+
+// triggerResponse is the body of the cycle trigger endpoints
+type triggerResponse struct {
+	Cycle  string `json:"cycle"`
+	Status string `json:"status"`
+}
+
+func (s *server) trigger(w http.ResponseWriter, name string, cycle func()) {
+	if !s.daemon.startCycle(name, cycle) {
+		writeError(w, http.StatusConflict, "another cycle is still running")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, triggerResponse{Cycle: name, Status: "started"})
+}
+
+// schema serves the JSON schema of a response or request body
+func (s *server) schema(w http.ResponseWriter, r *http.Request) {
+	data, err := schemas.ReadFile("schemas/" + r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "unknown schema")
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(data)
+}
+
+// strategy returns the shared strategy with the given name, writing a 400
+// for unknown names
+func (s *server) strategy(w http.ResponseWriter, name string) (crawler.Strategy, bool) {
+	if name == "" {
+		name = crawler.StrategyRoundRobin
+	}
+	strategy, ok := s.strategies[name]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown strategy %q, use one of %s",
+			name, strings.Join(crawler.StrategyNames, ", ")))
+	}
+	return strategy, ok
+}
+
+// targetJSON is one entry of a proxy's reachability matrix
+type targetJSON struct {
+	Reachable  bool   `json:"reachable"`
+	StatusCode int    `json:"status,omitempty"`
+	LatencyMs  int64  `json:"latency_ms"`
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+// proxyJSON is a proxy as the API returns it
+type proxyJSON struct {
+	Address       string                `json:"address"`
+	IP            string                `json:"ip"`
+	Port          string                `json:"port"`
+	Type          string                `json:"type"`
+	Country       string                `json:"country,omitempty"`
+	City          string                `json:"city,omitempty"`
+	ASN           uint                  `json:"asn,omitempty"`
+	Org           string                `json:"org,omitempty"`
+	ExitIP        string                `json:"exit_ip,omitempty"`
+	ExitCountry   string                `json:"exit_country,omitempty"`
+	ExitASN       uint                  `json:"exit_asn,omitempty"`
+	ExitOrg       string                `json:"exit_org,omitempty"`
+	IsWorking     bool                  `json:"is_working"`
+	LatencyMs     int64                 `json:"latency_ms"`
+	Throughput    float64               `json:"throughput_bps,omitempty"`
+	Score         float64               `json:"score"`
+	LastCheck     time.Time             `json:"last_check"`
+	LastUsed      *time.Time            `json:"last_used,omitempty"`
+	InFlight      int                   `json:"in_flight"`
+	ErrorClass    string                `json:"error_class,omitempty"`
+	Profiles      []string              `json:"profiles"`
+	Source        string                `json:"source,omitempty"`
+	Targets       map[string]targetJSON `json:"targets,omitempty"`
+	SuccessRatio  float64               `json:"success_ratio"`
+	LatencyEWMAMs int64                 `json:"latency_ewma_ms"`
+}
+
+func newProxyJSON(proxy crawler.ProxyInfo) proxyJSON {
+	view := proxyJSON{
+		Address:       proxy.Address,
+		IP:            proxy.IP,
+		Port:          proxy.Port,
+		Type:          string(proxy.Type),
+		Country:       proxy.Country,
+		City:          proxy.City,
+		ASN:           proxy.ASN,
+		Org:           proxy.Org,
+		ExitIP:        proxy.ExitIP,
+		ExitCountry:   proxy.ExitCountry,
+		ExitASN:       proxy.ExitASN,
+		ExitOrg:       proxy.ExitOrg,
+		IsWorking:     proxy.IsWorking,
+		LatencyMs:     proxy.Latency.Milliseconds(),
+		Throughput:    proxy.Throughput,
+		Score:         proxy.Score,
+		LastCheck:     proxy.LastCheck,
+		InFlight:      proxy.InFlight,
+		ErrorClass:    string(proxy.ErrorClass),
+		Profiles:      append([]string{}, proxy.Profiles...),
+		Source:        proxy.Source,
+		SuccessRatio:  proxy.History.SuccessRatio(),
+		LatencyEWMAMs: proxy.History.LatencyEWMA.Milliseconds(),
+	}
+	if !proxy.LastUsed.IsZero() {
+		lastUsed := proxy.LastUsed
+		view.LastUsed = &lastUsed
+	}
+	if len(proxy.Targets) > 0 {
+		view.Targets = make(map[string]targetJSON, len(proxy.Targets))
+		for name, result := range proxy.Targets {
+			view.Targets[name] = targetJSON{
+				Reachable:  result.IsWorking,
+				StatusCode: result.StatusCode,
+				LatencyMs:  result.Latency.Milliseconds(),
+				ErrorClass: string(result.ErrorClass),
+			}
+		}
+	}
+	return view
+}
+
+// errorResponse is the body of every error
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// readJSON decodes a request body into v, writing a 400 when it does not
+// parse. An empty body leaves v untouched.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// intParam parses an integer query parameter between lo and hi, hi < 0
+// meaning unbounded. An empty value returns def.
+func intParam(value string, def, lo, hi int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("must be an integer")
+	}
+	if n < lo || (hi >= 0 && n > hi) {
+		if hi >= 0 {
+			return 0, fmt.Errorf("must be between %d and %d", lo, hi)
+		}
+		return 0, fmt.Errorf("must be at least %d", lo)
+	}
+	return n, nil
+}
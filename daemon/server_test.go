@@ -0,0 +1,282 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regproxy/crawler"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProxies are the proxies newTestDaemon keeps, in insertion order
+var testProxies = []crawler.ProxyInfo{
+	{Address: "10.0.0.1:8080", Type: crawler.HTTP, Country: "US", IsWorking: true, Score: 0.9,
+		Profiles: []string{"tts"}, Targets: map[string]crawler.TargetResult{"a": {IsWorking: true}, "b": {IsWorking: true}}},
+	{Address: "10.0.0.2:1080", Type: crawler.SOCKS5, Country: "US", IsWorking: true, Score: 0.6,
+		Profiles: []string{"tts", "web"}, Targets: map[string]crawler.TargetResult{"a": {IsWorking: true}, "b": {IsWorking: false}}},
+	{Address: "10.0.0.3:1080", Type: crawler.SOCKS5, Country: "DE", IsWorking: true, Score: 0.4,
+		Profiles: []string{"web"}, Targets: map[string]crawler.TargetResult{"b": {IsWorking: true}}},
+	{Address: "10.0.0.4:3128", Type: crawler.HTTP, Country: "DE", IsWorking: false, Score: 0.1,
+		ErrorClass: crawler.ClassConnTimeout},
+	{Address: "10.0.0.5:1080", Type: crawler.SOCKS4, Country: "JP", IsWorking: true, Score: 0.7,
+		Profiles: []string{"tts"}, Targets: map[string]crawler.TargetResult{"a": {IsWorking: true}}},
+}
+
+// newTestDaemon creates a daemon that keeps testProxies
+func newTestDaemon(t *testing.T) *Daemon {
+	t.Helper()
+	d := newDaemon(t)
+
+	for _, proxy := range testProxies {
+		proxy.LastCheck = time.Now()
+		if err := d.manager.Upsert(proxy); err != nil {
+			t.Fatal(err)
+		}
+		for _, profile := range proxy.Profiles {
+			d.workingSets[profile] = append(d.workingSets[profile], proxy.Address)
+		}
+	}
+	d.publishStats()
+	return d
+}
+
+// serve sends a request to handler and returns the recorded response
+func serve(t *testing.T, handler http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		request.Header.Set(header[i], header[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// expect fails the test unless the response has the given status and a
+// body matching the named schema
+func expect(t *testing.T, c *schemaChecker, recorder *httptest.ResponseRecorder, status int, schema string) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("status %d, want %d: %s", recorder.Code, status, recorder.Body)
+	}
+	if schema != "" {
+		c.check(t, schema, recorder.Body.Bytes())
+	}
+}
+
+func decode[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		t.Fatalf("decoding %s: %v", recorder.Body, err)
+	}
+	return value
+}
+
+func addresses(proxies []proxyJSON) string {
+	var list []string
+	for _, proxy := range proxies {
+		list = append(list, proxy.Address)
+	}
+	return strings.Join(list, " ")
+}
+
+func TestHealth(t *testing.T) {
+	c := newSchemaChecker(t)
+	d := newTestDaemon(t)
+	handler := d.Handler("")
+
+	recorder := serve(t, handler, "GET", "/healthz", "")
+	expect(t, c, recorder, http.StatusServiceUnavailable, "health.json")
+	if health := decode[healthResponse](t, recorder); health.Status != "starting" || health.WorkingProxies != 4 {
+		t.Errorf("health = %+v", health)
+	}
+
+	d.ready.Store(true)
+	recorder = serve(t, handler, "GET", "/healthz", "")
+	expect(t, c, recorder, http.StatusOK, "health.json")
+	if health := decode[healthResponse](t, recorder); health.Status != "ready" || !health.Ready {
+		t.Errorf("health = %+v", health)
+	}
+}
+
+func TestListProxies(t *testing.T) {
+	c := newSchemaChecker(t)
+	handler := newTestDaemon(t).Handler("")
+
+	tests := []struct {
+		query string
+		total int
+		want  string
+	}{
+		{"", 5, "10.0.0.1:8080 10.0.0.2:1080 10.0.0.3:1080 10.0.0.4:3128 10.0.0.5:1080"},
+		{"limit=2", 5, "10.0.0.1:8080 10.0.0.2:1080"},
+		{"limit=2&offset=2", 5, "10.0.0.3:1080 10.0.0.4:3128"},
+		{"limit=2&offset=4", 5, "10.0.0.5:1080"},
+		{"offset=10", 5, ""},
+		{"type=SOCKS5", 2, "10.0.0.2:1080 10.0.0.3:1080"},
+		{"country=de", 2, "10.0.0.3:1080 10.0.0.4:3128"},
+		{"profile=tts", 3, "10.0.0.1:8080 10.0.0.2:1080 10.0.0.5:1080"},
+		{"target=a", 3, "10.0.0.1:8080 10.0.0.2:1080 10.0.0.5:1080"},
+		{"target=a,b", 1, "10.0.0.1:8080"},
+		{"working=false", 1, "10.0.0.4:3128"},
+		{"working=true&min_score=0.65", 2, "10.0.0.1:8080 10.0.0.5:1080"},
+		{"type=socks5&country=US&profile=web", 1, "10.0.0.2:1080"},
+		{"profile=none", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			recorder := serve(t, handler, "GET", "/proxies?"+tt.query, "")
+			expect(t, c, recorder, http.StatusOK, "proxy_list.json")
+			list := decode[proxyList](t, recorder)
+			if list.Total != tt.total || addresses(list.Proxies) != tt.want {
+				t.Errorf("total %d %q, want %d %q", list.Total, addresses(list.Proxies), tt.total, tt.want)
+			}
+		})
+	}
+}
+
+func TestListProxiesBadParams(t *testing.T) {
+	c := newSchemaChecker(t)
+	handler := newTestDaemon(t).Handler("")
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=ten", "offset=-1", "offset=x", "working=maybe", "min_score=high"} {
+		t.Run(query, func(t *testing.T) {
+			expect(t, c, serve(t, handler, "GET", "/proxies?"+query, ""), http.StatusBadRequest, "error.json")
+		})
+	}
+}
+
+func TestNextProxy(t *testing.T) {
+	c := newSchemaChecker(t)
+	d := newTestDaemon(t)
+	handler := d.Handler("")
+
+	recorder := serve(t, handler, "GET", "/proxies/next?strategy=fastest", "")
+	expect(t, c, recorder, http.StatusBadRequest, "error.json")
+
+	recorder = serve(t, handler, "GET", "/proxies/next?type=socks5&profile=tts", "")
+	expect(t, c, recorder, http.StatusOK, "proxy.json")
+	if proxy := decode[proxyJSON](t, recorder); proxy.Address != "10.0.0.2:1080" || proxy.InFlight != 0 {
+		t.Errorf("proxy = %s with %d in flight", proxy.Address, proxy.InFlight)
+	}
+
+	// A pick is released right away
+	if proxy, _ := d.manager.Get("10.0.0.2:1080"); proxy.InFlight != 0 {
+		t.Errorf("in flight = %d after /proxies/next", proxy.InFlight)
+	}
+
+	// The only proxy in DE reaching a is not working
+	recorder = serve(t, handler, "GET", "/proxies/next?country=DE&target=a", "")
+	expect(t, c, recorder, http.StatusServiceUnavailable, "error.json")
+}
+
+func TestLeaseFlow(t *testing.T) {
+	c := newSchemaChecker(t)
+	d := newTestDaemon(t)
+	handler := d.Handler("")
+
+	body := `{"strategy": "least_in_flight", "profile": "web", "targets": ["b"], "ttl_seconds": 60}`
+	if errs := c.validate("lease_request.json", []byte(body)); len(errs) > 0 {
+		t.Fatalf("request does not match lease_request.json: %v", errs)
+	}
+
+	recorder := serve(t, handler, "POST", "/leases", body)
+	expect(t, c, recorder, http.StatusCreated, "lease.json")
+	lease := decode[leaseResponse](t, recorder)
+	if lease.Proxy.Address != "10.0.0.3:1080" || lease.Proxy.InFlight != 1 {
+		t.Fatalf("leased %s with %d in flight", lease.Proxy.Address, lease.Proxy.InFlight)
+	}
+	if ttl := time.Until(lease.Expires); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("lease expires in %v", ttl)
+	}
+
+	recorder = serve(t, handler, "POST", "/leases/"+lease.ID+"/success", `{"latency_ms": 120}`)
+	expect(t, c, recorder, http.StatusNoContent, "")
+	if proxy, _ := d.manager.Get("10.0.0.3:1080"); proxy.InFlight != 0 {
+		t.Errorf("in flight = %d after the lease was closed", proxy.InFlight)
+	}
+
+	// A closed lease is gone
+	recorder = serve(t, handler, "POST", "/leases/"+lease.ID+"/failure", `{"error_class": "connect_timeout"}`)
+	expect(t, c, recorder, http.StatusNotFound, "error.json")
+
+	recorder = serve(t, handler, "POST", "/leases", `{"type": "socks4"}`)
+	expect(t, c, recorder, http.StatusCreated, "lease.json")
+	lease = decode[leaseResponse](t, recorder)
+	recorder = serve(t, handler, "POST", "/leases/"+lease.ID+"/failure", `{"error_class": "connect_timeout"}`)
+	expect(t, c, recorder, http.StatusNoContent, "")
+	if proxy, _ := d.manager.Get(lease.Proxy.Address); proxy.FeedbackFailures != 1 {
+		t.Errorf("feedback failures = %d", proxy.FeedbackFailures)
+	}
+
+	expect(t, c, serve(t, handler, "POST", "/leases/unknown/success", `{}`), http.StatusNotFound, "error.json")
+	expect(t, c, serve(t, handler, "POST", "/leases", `{"strategy": "fastest"}`), http.StatusBadRequest, "error.json")
+	expect(t, c, serve(t, handler, "POST", "/leases", `{"ttl_seconds": -1}`), http.StatusBadRequest, "error.json")
+	expect(t, c, serve(t, handler, "POST", "/leases", `{"session": "x"}`), http.StatusBadRequest, "error.json")
+	expect(t, c, serve(t, handler, "POST", "/leases", `{"country": "FR"}`), http.StatusServiceUnavailable, "error.json")
+}
+
+func TestAuth(t *testing.T) {
+	c := newSchemaChecker(t)
+	handler := newTestDaemon(t).Handler("s3cret")
+
+	expect(t, c, serve(t, handler, "GET", "/proxies", ""), http.StatusUnauthorized, "error.json")
+	expect(t, c, serve(t, handler, "GET", "/proxies", "", "Authorization", "Bearer wrong"), http.StatusUnauthorized, "error.json")
+	expect(t, c, serve(t, handler, "GET", "/proxies", "", "Authorization", "s3cret"), http.StatusUnauthorized, "error.json")
+	expect(t, c, serve(t, handler, "POST", "/leases", "{}"), http.StatusUnauthorized, "error.json")
+	expect(t, c, serve(t, handler, "GET", "/proxies", "", "Authorization", "Bearer s3cret"), http.StatusOK, "proxy_list.json")
+
+	// Health checks do not need the token
+	expect(t, c, serve(t, handler, "GET", "/healthz", ""), http.StatusServiceUnavailable, "health.json")
+}
+
+func TestStatsAndCycles(t *testing.T) {
+	c := newSchemaChecker(t)
+	d := newTestDaemon(t)
+	handler := d.Handler("")
+
+	d.recordCycle("crawl", time.Now(), crawler.ComputeStats(d.manager.GetProxies()), nil)
+	d.recordCycle("retest", time.Now(), crawler.ComputeStats(nil), context.Canceled)
+	d.lastCycle = crawler.ComputeStats(d.manager.GetProxies())
+	d.publishStats()
+
+	recorder := serve(t, handler, "GET", "/stats", "")
+	expect(t, c, recorder, http.StatusOK, "stats.json")
+	if stats := decode[map[string]any](t, recorder); stats["working_proxies"] != 4.0 {
+		t.Errorf("working_proxies = %v", stats["working_proxies"])
+	}
+
+	recorder = serve(t, handler, "GET", "/cycles", "")
+	expect(t, c, recorder, http.StatusOK, "cycles.json")
+	if cycles := decode[cycleList](t, recorder).Cycles; len(cycles) != 2 || cycles[0].Type != "retest" || cycles[0].Error == "" {
+		t.Errorf("cycles = %+v", cycles)
+	}
+}
+
+func TestTriggerWhileCycleRuns(t *testing.T) {
+	c := newSchemaChecker(t)
+	d := newTestDaemon(t)
+	handler := d.Handler("")
+
+	d.cycleMu.Lock()
+	defer d.cycleMu.Unlock()
+
+	expect(t, c, serve(t, handler, "POST", "/cycles/crawl", ""), http.StatusConflict, "error.json")
+	expect(t, c, serve(t, handler, "POST", "/cycles/test", ""), http.StatusConflict, "error.json")
+}
+
+func TestServeSchemas(t *testing.T) {
+	c := newSchemaChecker(t)
+	handler := newTestDaemon(t).Handler("")
+
+	recorder := serve(t, handler, "GET", "/schemas/proxy.json", "")
+	expect(t, c, recorder, http.StatusOK, "")
+	if recorder.Header().Get("Content-Type") != "application/schema+json" {
+		t.Errorf("content type %q", recorder.Header().Get("Content-Type"))
+	}
+	expect(t, c, serve(t, handler, "GET", "/schemas/secrets.yaml", ""), http.StatusNotFound, "error.json")
+}
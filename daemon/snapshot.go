@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regproxy/crawler"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes in a way
+// older daemons cannot read
+const snapshotVersion = 1
+
+// snapshotFile is the full proxy state of the daemon, written every cycle
+// so a restart without MongoDB keeps latency, type, score and lifecycle
+type snapshotFile struct {
+	Version     int                             `json:"version"`
+	SavedAt     time.Time                       `json:"saved_at"`
+	Proxies     []crawler.ProxyInfo             `json:"proxies"`
+	WorkingSets map[string][]string             `json:"working_sets"`
+	ExitIPs     map[string]string               `json:"exit_ips"`
+	History     map[string]crawler.ProxyHistory `json:"history"`
+	States      map[string]crawler.ProxyStatus  `json:"states"`
+	Types       map[string]crawler.ProxyType    `json:"types,omitempty"`
+}
+
+// saveSnapshot writes the snapshot, replacing the previous one atomically
+func (d *Daemon) saveSnapshot() error {
+	path := d.config.Files.Snapshot
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(snapshotFile{
+		Version:     snapshotVersion,
+		SavedAt:     time.Now(),
+		Proxies:     d.manager.GetProxies(),
+		WorkingSets: d.workingSets,
+		ExitIPs:     d.exitIPs,
+		History:     d.history,
+		States:      d.states,
+		Types:       d.types,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing snapshot: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// restoreSnapshot loads the snapshot into the daemon and reports whether
+// there was one. Working sets of profiles that are no longer configured
+// are dropped.
+func (d *Daemon) restoreSnapshot() (bool, error) {
+	path := d.config.Files.Snapshot
+	if path == "" {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return false, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return false, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	for _, profile := range d.profiles {
+		d.workingSets[profile.Name] = snapshot.WorkingSets[profile.Name]
+	}
+	for proxy, exitIP := range snapshot.ExitIPs {
+		d.exitIPs[proxy] = exitIP
+	}
+	for proxy, history := range snapshot.History {
+		d.history[proxy] = history
+	}
+	for proxy, status := range snapshot.States {
+		d.states[proxy] = status
+	}
+	for proxy, proxyType := range snapshot.Types {
+		d.types[proxy] = proxyType
+	}
+
+	// Nothing is in flight after a restart
+	d.manager.Clear()
+	for _, proxy := range snapshot.Proxies {
+		proxy.InFlight = 0
+		if _, ok := d.types[proxy.Address]; !ok && proxy.Type != "" {
+			d.types[proxy.Address] = proxy.Type
+		}
+		if err := d.manager.Upsert(proxy); err != nil {
+			d.logger.Warn("Skipping snapshot entry: %v", err)
+		}
+	}
+
+	d.logger.Info("Restored %d working proxies and the state of %d proxies from the snapshot of %s",
+		len(d.GetWorkingProxies()), len(snapshot.States), snapshot.SavedAt.Format(time.RFC3339))
+	return true, nil
+}
@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regproxy/crawler"
+	"testing"
+	"time"
+)
+
+var snapshotTime = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newSnapshotDaemon creates a daemon that keeps its snapshot in dir
+func newSnapshotDaemon(t *testing.T, dir string) *Daemon {
+	t.Helper()
+	d := newDaemon(t)
+	d.config.Files.Snapshot = filepath.Join(dir, "snapshot.json")
+	return d
+}
+
+// snapshotFiles lists the files in dir
+func snapshotFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	d := newSnapshotDaemon(t, dir)
+
+	proxies := []crawler.ProxyInfo{
+		{Address: "10.0.0.1:8080", IP: "10.0.0.1", Port: "8080", Type: crawler.HTTP, Country: "US",
+			Latency: 120 * time.Millisecond, LastCheck: snapshotTime, IsWorking: true, Profiles: []string{"tts"},
+			Score: 0.8, InFlight: 2, Targets: map[string]crawler.TargetResult{"web": {IsWorking: true, StatusCode: 200}}},
+		{Address: "10.0.0.2:1080", IP: "10.0.0.2", Port: "1080", Type: crawler.SOCKS5, Country: "DE",
+			LastCheck: snapshotTime, ErrorClass: crawler.ClassConnTimeout},
+	}
+	for _, proxy := range proxies {
+		if err := d.manager.Upsert(proxy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.workingSets["tts"] = []string{"10.0.0.1:8080"}
+	d.workingSets["removed"] = []string{"10.0.0.2:1080"}
+	d.exitIPs["10.0.0.1:8080"] = "198.51.100.1"
+	d.history["10.0.0.1:8080"] = crawler.ProxyHistory{FirstSeen: snapshotTime, LatencyEWMA: 100 * time.Millisecond, Successes: 3, Attempts: 4}
+	d.states["10.0.0.2:1080"] = crawler.ProxyStatus{State: crawler.StateSuspect, Since: snapshotTime, Failures: 1, NextTest: snapshotTime.Add(time.Minute)}
+	d.types["10.0.0.2:1080"] = crawler.SOCKS5
+
+	if err := d.saveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if files := snapshotFiles(t, dir); !reflect.DeepEqual(files, []string{"snapshot.json"}) {
+		t.Fatalf("files after saving: %v", files)
+	}
+
+	restored := newSnapshotDaemon(t, dir)
+	ok, err := restored.restoreSnapshot()
+	if err != nil || !ok {
+		t.Fatalf("restoreSnapshot = %v, %v", ok, err)
+	}
+
+	// Nothing is in flight after a restart
+	proxies[0].InFlight = 0
+	if got := restored.manager.GetProxies(); !reflect.DeepEqual(got, proxies) {
+		t.Errorf("proxies:\n%+v\nwant\n%+v", got, proxies)
+	}
+	// Working sets of profiles that are gone are dropped
+	if want := map[string][]string{"tts": {"10.0.0.1:8080"}, "web": nil}; !reflect.DeepEqual(restored.workingSets, want) {
+		t.Errorf("working sets %v, want %v", restored.workingSets, want)
+	}
+	if !reflect.DeepEqual(restored.exitIPs, d.exitIPs) {
+		t.Errorf("exit IPs %v", restored.exitIPs)
+	}
+	if !reflect.DeepEqual(restored.history, d.history) {
+		t.Errorf("history %+v", restored.history)
+	}
+	if !reflect.DeepEqual(restored.states, d.states) {
+		t.Errorf("states %+v", restored.states)
+	}
+	// Proxies without a recorded type take the one they were stored with
+	wantTypes := map[string]crawler.ProxyType{"10.0.0.1:8080": crawler.HTTP, "10.0.0.2:1080": crawler.SOCKS5}
+	if !reflect.DeepEqual(restored.types, wantTypes) {
+		t.Errorf("types %v, want %v", restored.types, wantTypes)
+	}
+}
+
+func TestSnapshotReplacedAtomically(t *testing.T) {
+	dir := t.TempDir()
+	d := newSnapshotDaemon(t, dir)
+
+	d.manager.Upsert(crawler.ProxyInfo{Address: "10.0.0.1:8080", IsWorking: true})
+	if err := d.saveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	d.manager.Upsert(crawler.ProxyInfo{Address: "10.0.0.2:8080", IsWorking: true})
+	if err := d.saveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The temporary file is renamed over the snapshot, never left behind
+	if files := snapshotFiles(t, dir); !reflect.DeepEqual(files, []string{"snapshot.json"}) {
+		t.Fatalf("files after saving twice: %v", files)
+	}
+	restored := newSnapshotDaemon(t, dir)
+	if _, err := restored.restoreSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if restored.manager.Count() != 2 {
+		t.Errorf("restored %d proxies, want the 2 of the second save", restored.manager.Count())
+	}
+
+	// A snapshot that cannot be written leaves nothing behind
+	d.config.Files.Snapshot = filepath.Join(dir, "missing", "snapshot.json")
+	if err := d.saveSnapshot(); err == nil {
+		t.Error("saving into a missing directory succeeded")
+	}
+	if files := snapshotFiles(t, dir); !reflect.DeepEqual(files, []string{"snapshot.json"}) {
+		t.Errorf("files after a failed save: %v", files)
+	}
+}
+
+func TestSnapshotMissing(t *testing.T) {
+	d := newSnapshotDaemon(t, t.TempDir())
+	if ok, err := d.restoreSnapshot(); ok || err != nil {
+		t.Errorf("restoreSnapshot without a file = %v, %v", ok, err)
+	}
+
+	d.config.Files.Snapshot = ""
+	if ok, err := d.restoreSnapshot(); ok || err != nil {
+		t.Errorf("restoreSnapshot when disabled = %v, %v", ok, err)
+	}
+	if err := d.saveSnapshot(); err != nil {
+		t.Errorf("saveSnapshot when disabled: %v", err)
+	}
+}
+
+func TestSnapshotRejectsOtherVersions(t *testing.T) {
+	dir := t.TempDir()
+	d := newSnapshotDaemon(t, dir)
+	if err := os.WriteFile(d.config.Files.Snapshot, []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.restoreSnapshot(); ok || err == nil {
+		t.Errorf("restoreSnapshot of version 99 = %v, %v", ok, err)
+	}
+
+	if err := os.WriteFile(d.config.Files.Snapshot, []byte(`{"version": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.restoreSnapshot(); ok || err == nil {
+		t.Errorf("restoreSnapshot of a truncated file = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,200 @@
+package daemon
+
+import (
+	"context"
+	"regproxy/crawler"
+	"regproxy/storage"
+	"time"
+)
+
+// Stats is a snapshot of the daemon for the logs and the API
+type Stats struct {
+	WorkingProxies int       `json:"working_proxies"`
+	LastCrawl      time.Time `json:"last_crawl"`
+	UptimeSeconds  int64     `json:"uptime_seconds"`
+	MongoDBEnabled bool      `json:"mongodb_enabled"`
+	Concurrency    int       `json:"concurrency"`
+	// Profiles is the number of kept proxies of each profile
+	Profiles map[string]int `json:"profiles"`
+	// ExitIPs is the number of distinct exit IPs of the kept proxies
+	ExitIPs int `json:"exit_ips"`
+	// States counts the tracked proxies in each lifecycle state
+	States map[crawler.ProxyState]int `json:"states"`
+	// Targets is the number of working proxies that reach each check's
+	// target
+	Targets map[string]int `json:"targets"`
+	// Pool describes the kept proxies and LastCycle every proxy tested in
+	// the last cycle
+	Pool       crawler.ProxyStats  `json:"pool"`
+	LastCycle  crawler.ProxyStats  `json:"last_cycle"`
+	LastAlert  *AlertStats         `json:"last_alert,omitempty"`
+	QuotaUsage *QuotaUsage         `json:"quota_usage,omitempty"`
+	MongoDB    *storage.ProxyStats `json:"mongodb,omitempty"`
+}
+
+// AlertStats is the last alert the daemon raised
+type AlertStats struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// QuotaUsage is the API quota spent by each check
+type QuotaUsage struct {
+	LastCycle map[string]int64 `json:"last_cycle"`
+	Total     map[string]int64 `json:"total"`
+}
+
+// CycleRecord describes a finished test cycle
+type CycleRecord struct {
+	// Type is "crawl", "maintenance" or "retest"
+	Type       string             `json:"type"`
+	StartedAt  time.Time          `json:"started_at"`
+	DurationMs int64              `json:"duration_ms"`
+	Error      string             `json:"error,omitempty"`
+	Stats      crawler.ProxyStats `json:"stats"`
+}
+
+// maxCycleRecords is how many cycles the history keeps
+const maxCycleRecords = 100
+
+// GetStats returns daemon statistics. It is safe to call while a cycle is
+// running: the daemon's own state is as of the last finished cycle, the
+// pool and MongoDB stats are current.
+func (d *Daemon) GetStats() Stats {
+	d.mu.RLock()
+	stats := d.published
+	d.mu.RUnlock()
+
+	stats.UptimeSeconds = int64(time.Since(d.startTime).Seconds())
+	stats.Concurrency = d.runner.Concurrency()
+	stats.Pool = d.manager.GetStats()
+
+	// Add MongoDB stats if available
+	if d.mongoStorage != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		mongoStats, err := d.mongoStorage.GetProxyStats(ctx)
+		if err != nil {
+			d.logger.Info("Warning: Could not get MongoDB stats: %v", err)
+		} else {
+			stats.MongoDB = mongoStats
+		}
+	}
+
+	return stats
+}
+
+// GetCycles returns the most recent cycles, oldest first
+func (d *Daemon) GetCycles() []CycleRecord {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]CycleRecord(nil), d.cycles...)
+}
+
+// recordCycle adds a finished cycle to the history
+func (d *Daemon) recordCycle(testType string, start time.Time, stats crawler.ProxyStats, err error) {
+	record := CycleRecord{
+		Type:       testType,
+		StartedAt:  start,
+		DurationMs: time.Since(start).Milliseconds(),
+		Stats:      stats,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cycles = append(d.cycles, record)
+	if len(d.cycles) > maxCycleRecords {
+		d.cycles = d.cycles[len(d.cycles)-maxCycleRecords:]
+	}
+}
+
+// publishStats makes the daemon's state visible to GetStats. It is called
+// by whichever goroutine runs the cycles, once a cycle has finished.
+func (d *Daemon) publishStats() {
+	stats := Stats{
+		WorkingProxies: len(d.GetWorkingProxies()),
+		LastCrawl:      d.lastCrawlTime,
+		MongoDBEnabled: d.mongoStorage != nil,
+		Profiles:       make(map[string]int, len(d.profiles)),
+		ExitIPs:        crawler.CountExitIPs(d.GetWorkingProxies(), d.exitIPs),
+		States:         make(map[crawler.ProxyState]int),
+		Targets:        make(map[string]int),
+		LastCycle:      d.lastCycle,
+	}
+
+	for _, profile := range d.profiles {
+		stats.Profiles[profile.Name] = len(d.workingSets[profile.Name])
+	}
+
+	for _, status := range d.states {
+		stats.States[status.State]++
+	}
+
+	for _, proxy := range d.manager.GetWorkingProxies() {
+		for name, result := range proxy.Targets {
+			if result.IsWorking {
+				stats.Targets[name]++
+			}
+		}
+	}
+
+	if d.lastAlert != "" {
+		stats.LastAlert = &AlertStats{Message: d.lastAlert, Time: d.lastAlertTime}
+	}
+
+	// The usage maps are updated in place, so publish copies
+	if len(d.totalUsage) > 0 {
+		stats.QuotaUsage = &QuotaUsage{LastCycle: copyUsage(d.lastUsage), Total: copyUsage(d.totalUsage)}
+	}
+
+	d.mu.Lock()
+	d.published = stats
+	d.mu.Unlock()
+}
+
+func copyUsage(usage map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(usage))
+	for name, used := range usage {
+		copied[name] = used
+	}
+	return copied
+}
+
+// cycleInfo describes a tested proxy for the cycle stats. Proxies that
+// passed a check but no profile count with the class of a failed check.
+func (d *Daemon) cycleInfo(result crawler.CheckResult, checks map[string]crawler.CheckResult, working bool) crawler.ProxyInfo {
+	info := crawler.InfoFromResult(result)
+	info.IsWorking = working
+	info.Type = d.proxyType(result.Proxy)
+	info.Source = d.sourceOf(result.Proxy)
+
+	if !working && info.ErrorClass == "" {
+		for _, name := range d.checkOrder {
+			if check, ok := checks[name]; ok && !check.IsWorking {
+				info.ErrorClass = check.ErrorClass
+				break
+			}
+		}
+	}
+
+	if d.geoip != nil {
+		info.Country = d.geoip.LookupString(info.IP).Country
+	}
+	return info
+}
+
+// sourceOf returns the source a proxy was crawled from, falling back to
+// what the manager knows for proxies the last crawl did not list
+func (d *Daemon) sourceOf(proxy string) string {
+	if source := d.crawler.SourceOf(proxy); source != "" {
+		return source
+	}
+	if info, ok := d.manager.Get(proxy); ok {
+		return info.Source
+	}
+	return ""
+}
@@ -0,0 +1,239 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// MaxMind DB data section types
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// maxDepth bounds nesting so a corrupt file cannot recurse forever
+const maxDepth = 32
+
+// decoder reads values from a MaxMind DB data section. Pointers are
+// offsets from the start of buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode decodes the value at offset and returns it with the offset just
+// past it. Maps decode to map[string]any, arrays to []any, unsigned
+// integers to uint64 and uint128 to *big.Int.
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	return d.decodeDepth(offset, 0)
+}
+
+func (d *decoder) decodeDepth(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("data nested too deep")
+	}
+
+	typeNum, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typeNum == typePointer {
+		pointer, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decodeDepth(pointer, depth+1)
+		return value, next, err
+	}
+
+	return d.value(typeNum, size, offset, depth)
+}
+
+// control reads the control byte (and extended type and size bytes) at
+// offset. For pointers size holds the raw control byte bits.
+func (d *decoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+
+	typeNum := int(ctrl >> 5)
+	if typeNum == typePointer {
+		return typeNum, uint(ctrl & 0x1F), offset, nil
+	}
+
+	if typeNum == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+		}
+		typeNum = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+		}
+		n := uintFromBytes(d.buf[offset : offset+extra])
+		offset += extra
+
+		switch size {
+		case 29:
+			size = 29 + n
+		case 30:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+	}
+
+	return typeNum, size, offset, nil
+}
+
+// pointer decodes a pointer whose control byte carried bits
+func (d *decoder) pointer(bits uint, offset uint) (uint, uint, error) {
+	length := (bits>>3)&0x3 + 1
+	if offset+length > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+	}
+	b := d.buf[offset : offset+length]
+
+	var pointer uint
+	switch length {
+	case 1:
+		pointer = (bits&0x7)<<8 | uint(b[0])
+	case 2:
+		pointer = ((bits&0x7)<<16 | uintFromBytes(b)) + 2048
+	case 3:
+		pointer = ((bits&0x7)<<24 | uintFromBytes(b)) + 526336
+	default:
+		pointer = uintFromBytes(b)
+	}
+
+	return pointer, offset + length, nil
+}
+
+// value decodes a value of a known type and size
+func (d *decoder) value(typeNum int, size uint, offset uint, depth int) (any, uint, error) {
+	switch typeNum {
+	case typeMap:
+		return d.decodeMap(size, offset, depth)
+	case typeArray:
+		return d.decodeArray(size, offset, depth)
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typeNum {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid integer size %d", size)
+		}
+		return uint64(uintFromBytes(b)), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		return int64(int32(uintFromBytes(b))), next, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typeNum)
+	}
+}
+
+func (d *decoder) decodeMap(size uint, offset uint, depth int) (any, uint, error) {
+	// A key and a value take at least a byte each
+	m := make(map[string]any, d.capacity(size, offset, 2))
+	for i := uint(0); i < size; i++ {
+		key, next, err := d.decodeDepth(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		keyStr, ok := key.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("map key is %T, not a string", key)
+		}
+
+		value, next, err := d.decodeDepth(next, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		m[keyStr] = value
+		offset = next
+	}
+	return m, offset, nil
+}
+
+func (d *decoder) decodeArray(size uint, offset uint, depth int) (any, uint, error) {
+	a := make([]any, 0, d.capacity(size, offset, 1))
+	for i := uint(0); i < size; i++ {
+		value, next, err := d.decodeDepth(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		a = append(a, value)
+		offset = next
+	}
+	return a, offset, nil
+}
+
+// capacity bounds the element count a map or array claims by what the
+// bytes left after offset can hold, so a corrupt size cannot make us
+// allocate gigabytes up front
+func (d *decoder) capacity(size, offset, minElementSize uint) uint {
+	if offset >= uint(len(d.buf)) {
+		return 0
+	}
+	return min(size, (uint(len(d.buf))-offset)/minElementSize)
+}
+
+// uintFromBytes reads a big-endian unsigned integer of up to 8 bytes
+func uintFromBytes(b []byte) uint {
+	var n uint
+	for _, c := range b {
+		n = n<<8 | uint(c)
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// Default file names looked for in the database directory
+const (
+	CountryFile = "GeoLite2-Country.mmdb"
+	CityFile    = "GeoLite2-City.mmdb"
+	ASNFile     = "GeoLite2-ASN.mmdb"
+)
+
+// Info is what the databases know about an IP address
+type Info struct {
+	Country string
+	City    string
+	ASN     uint
+	Org     string
+}
+
+// IsZero reports whether no database had a record for the address
+func (i Info) IsZero() bool {
+	return i == Info{}
+}
+
+// Enricher looks addresses up in whichever of the country, city and ASN
+// databases are available
+type Enricher struct {
+	country *Reader
+	city    *Reader
+	asn     *Reader
+}
+
+// OpenDir opens the databases with the default file names in dir. Missing
+// files are skipped, but at least one database must exist.
+func OpenDir(dir string) (*Enricher, error) {
+	return OpenFiles(
+		filepath.Join(dir, CountryFile),
+		filepath.Join(dir, CityFile),
+		filepath.Join(dir, ASNFile),
+	)
+}
+
+// OpenFiles opens the given databases. Empty or missing paths are skipped,
+// but at least one database must exist.
+func OpenFiles(countryPath, cityPath, asnPath string) (*Enricher, error) {
+	e := &Enricher{}
+
+	for _, db := range []struct {
+		path   string
+		reader **Reader
+	}{
+		{countryPath, &e.country},
+		{cityPath, &e.city},
+		{asnPath, &e.asn},
+	} {
+		if db.path == "" {
+			continue
+		}
+		reader, err := Open(db.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		*db.reader = reader
+	}
+
+	if e.country == nil && e.city == nil && e.asn == nil {
+		return nil, fmt.Errorf("no GeoIP databases found")
+	}
+	return e, nil
+}
+
+// Databases returns the types of the opened databases
+func (e *Enricher) Databases() []string {
+	var types []string
+	for _, reader := range []*Reader{e.country, e.city, e.asn} {
+		if reader != nil {
+			types = append(types, reader.Metadata.DatabaseType)
+		}
+	}
+	return types
+}
+
+// Lookup returns what the databases know about ip. Lookup errors leave the
+// affected fields empty.
+func (e *Enricher) Lookup(ip net.IP) Info {
+	var info Info
+
+	// The city database carries countries too, so it can stand in for the
+	// country database
+	for _, reader := range []*Reader{e.city, e.country} {
+		if reader == nil {
+			continue
+		}
+		record, err := reader.Lookup(ip)
+		if err != nil || record == nil {
+			continue
+		}
+		if info.Country == "" {
+			info.Country = nestedString(record, "country", "iso_code")
+		}
+		if info.City == "" {
+			info.City = nestedString(record, "city", "names", "en")
+		}
+	}
+
+	if e.asn != nil {
+		if record, err := e.asn.Lookup(ip); err == nil && record != nil {
+			info.ASN = uint(uintField(record, "autonomous_system_number"))
+			info.Org = stringField(record, "autonomous_system_organization")
+		}
+	}
+
+	return info
+}
+
+// LookupString looks up an address given as a string, returning an empty
+// Info when it does not parse
+func (e *Enricher) LookupString(address string) Info {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return Info{}
+	}
+	return e.Lookup(ip)
+}
+
+// nestedString follows keys through nested maps to a string
+func nestedString(m map[string]any, keys ...string) string {
+	for i, key := range keys {
+		if i == len(keys)-1 {
+			return stringField(m, key)
+		}
+		next, ok := m[key].(map[string]any)
+		if !ok {
+			return ""
+		}
+		m = next
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package geoip
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regproxy/geoip/internal/mmdbtest"
+	"testing"
+)
+
+// TestFixturesUpToDate fails when the committed databases in testdata do
+// not match fixtures.json. Run make geoip-fixtures after editing it.
+func TestFixturesUpToDate(t *testing.T) {
+	data, err := os.ReadFile("testdata/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	databases, err := mmdbtest.BuildFixtures(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, built := range databases {
+		committed, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(built, committed) {
+			t.Errorf("testdata/%s is out of date, run make geoip-fixtures", name)
+		}
+	}
+}
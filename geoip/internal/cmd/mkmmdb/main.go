@@ -0,0 +1,45 @@
+// Command mkmmdb builds MaxMind DB files from a JSON description. It is
+// used to generate the GeoIP fixture databases in geoip/testdata.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regproxy/geoip/internal/mmdbtest"
+	"sort"
+)
+
+func main() {
+	var (
+		input  = flag.String("in", "geoip/testdata/fixtures.json", "JSON description of the databases")
+		output = flag.String("out", "geoip/testdata", "Directory to write the .mmdb files to")
+	)
+	flag.Parse()
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", *input, err)
+	}
+
+	databases, err := mmdbtest.BuildFixtures(data)
+	if err != nil {
+		log.Fatalf("Error building %s: %v", *input, err)
+	}
+
+	names := make([]string, 0, len(databases))
+	for name := range databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(*output, name)
+		if err := os.WriteFile(path, databases[name], 0644); err != nil {
+			log.Fatalf("Error writing %s: %v", path, err)
+		}
+		fmt.Printf("Wrote %s (%d bytes)\n", path, len(databases[name]))
+	}
+}
@@ -0,0 +1,74 @@
+package mmdbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+// Fixture describes one database of a fixtures file: its type, build time
+// and the record of each network
+type Fixture struct {
+	DatabaseType string                    `json:"database_type"`
+	BuildEpoch   int64                     `json:"build_epoch"`
+	Networks     map[string]map[string]any `json:"networks"`
+}
+
+// BuildFixtures builds the databases described by a JSON fixtures file,
+// such as geoip/testdata/fixtures.json, keyed by file name. The output
+// only depends on the input, so rebuilt fixtures match the committed ones.
+func BuildFixtures(data []byte) (map[string][]byte, error) {
+	var fixtures map[string]Fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, err
+	}
+
+	databases := make(map[string][]byte, len(fixtures))
+	for name, fixture := range fixtures {
+		writer := NewWriter(fixture.DatabaseType)
+		writer.SetBuildEpoch(time.Unix(fixture.BuildEpoch, 0))
+
+		for cidr, record := range fixture.Networks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			if err := writer.Insert(network, convertNumbers(record).(map[string]any)); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+
+		db, err := writer.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		databases[name] = db
+	}
+	return databases, nil
+}
+
+// convertNumbers turns the float64 numbers JSON decodes into the unsigned
+// integers MaxMind databases use, such as ASNs and geoname IDs
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if v >= 0 && v == math.Trunc(v) && v <= math.MaxUint32 {
+			return uint32(v)
+		}
+		return v
+	case map[string]any:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,321 @@
+// Package mmdbtest builds small MaxMind DB files for tests and for the
+// fixture databases in geoip/testdata. It is not part of the runtime API,
+// the daemon only reads databases.
+package mmdbtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"time"
+)
+
+// Data section types and file layout, see the MaxMind DB format spec
+const (
+	typeString = 2
+	typeDouble = 3
+	typeBytes  = 4
+	typeUint16 = 5
+	typeUint32 = 6
+	typeMap    = 7
+	typeUint64 = 9
+	typeArray  = 11
+	typeBool   = 14
+
+	dataSectionSeparator = 16
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// Writer builds small MaxMind DB files, such as the fixture databases
+// generated by mkmmdb. Networks must not overlap.
+type Writer struct {
+	databaseType string
+	root         *writerNode
+	recordSize   uint
+	buildEpoch   time.Time
+}
+
+// writerNode is a node of the in-memory search tree. A node is either a
+// leaf holding a record or has up to two children.
+type writerNode struct {
+	children [2]*writerNode
+	record   any
+	leaf     bool
+}
+
+// NewWriter creates a writer for an IPv6 database of the given type, such
+// as "GeoLite2-Country". IPv4 networks are stored under ::/96.
+func NewWriter(databaseType string) *Writer {
+	return &Writer{
+		databaseType: databaseType,
+		root:         &writerNode{},
+	}
+}
+
+// SetRecordSize forces the record size of the search tree to 24, 28 or 32
+// bits instead of the smallest size that fits. Bytes fails when the
+// database does not fit.
+func (w *Writer) SetRecordSize(size uint) {
+	w.recordSize = size
+}
+
+// SetBuildEpoch sets the build time written to the metadata, the time of
+// Bytes by default. A fixed time makes the output reproducible.
+func (w *Writer) SetBuildEpoch(epoch time.Time) {
+	w.buildEpoch = epoch
+}
+
+// Insert stores record for every address in network. Records may hold
+// maps, slices, strings, bools, float64 and unsigned integers.
+func (w *Writer) Insert(network *net.IPNet, record map[string]any) error {
+	ones, bits := network.Mask.Size()
+	ip := network.IP.To16()
+	if bits == 32 {
+		// ::a.b.c.d rather than the ::ffff:a.b.c.d form To16 returns
+		ip = append(make(net.IP, 12), network.IP.To4()...)
+		ones += 96
+	}
+
+	node := w.root
+	for i := 0; i < ones; i++ {
+		if node.leaf {
+			return fmt.Errorf("%s overlaps an existing network", network)
+		}
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &writerNode{}
+		}
+		node = node.children[bit]
+	}
+
+	if node.leaf || node.children[0] != nil || node.children[1] != nil {
+		return fmt.Errorf("%s overlaps an existing network", network)
+	}
+	node.leaf = true
+	node.record = record
+	return nil
+}
+
+// WriteFile writes the database to path
+func (w *Writer) WriteFile(path string) error {
+	data, err := w.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Bytes serializes the database
+func (w *Writer) Bytes() ([]byte, error) {
+	// Number the internal nodes breadth first, the root is node 0
+	var nodes []*writerNode
+	numbers := make(map[*writerNode]uint)
+	queue := []*writerNode{w.root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node.leaf {
+			continue
+		}
+		numbers[node] = uint(len(nodes))
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+	nodeCount := uint(len(nodes))
+
+	// Encode every record into the data section
+	var data bytes.Buffer
+	offsets := make(map[*writerNode]uint)
+	for _, node := range nodes {
+		for _, child := range node.children {
+			if child == nil || !child.leaf {
+				continue
+			}
+			offsets[child] = uint(data.Len())
+			if err := Encode(&data, child.record); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	recordValue := func(child *writerNode) uint {
+		switch {
+		case child == nil:
+			return nodeCount
+		case child.leaf:
+			return nodeCount + dataSectionSeparator + offsets[child]
+		default:
+			return numbers[child]
+		}
+	}
+
+	// Pick the smallest record size that fits the largest value
+	maxValue := nodeCount + dataSectionSeparator + uint(data.Len())
+	recordSize := w.recordSize
+	switch {
+	case recordSize != 0:
+		if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+			return nil, fmt.Errorf("unsupported record size %d", recordSize)
+		}
+		if uint64(maxValue) >= 1<<recordSize {
+			return nil, fmt.Errorf("database does not fit %d-bit records", recordSize)
+		}
+	case maxValue >= 1<<28:
+		recordSize = 32
+	case maxValue >= 1<<24:
+		recordSize = 28
+	default:
+		recordSize = 24
+	}
+
+	buildEpoch := w.buildEpoch
+	if buildEpoch.IsZero() {
+		buildEpoch = time.Now()
+	}
+
+	var out bytes.Buffer
+	for _, node := range nodes {
+		out.Write(EncodeNode(recordSize, recordValue(node.children[0]), recordValue(node.children[1])))
+	}
+	out.Write(make([]byte, dataSectionSeparator))
+	out.Write(data.Bytes())
+
+	out.Write(metadataMarker)
+	metadata := map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(buildEpoch.Unix()),
+		"database_type":               w.databaseType,
+		"description":                 map[string]any{"en": w.databaseType + " fixture"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+	}
+	if err := Encode(&out, metadata); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// EncodeNode packs the two records of a search tree node
+func EncodeNode(recordSize, left, right uint) []byte {
+	switch recordSize {
+	case 24:
+		return []byte{
+			byte(left >> 16), byte(left >> 8), byte(left),
+			byte(right >> 16), byte(right >> 8), byte(right),
+		}
+	case 28:
+		return []byte{
+			byte(left >> 16), byte(left >> 8), byte(left),
+			byte(left>>20)&0xF0 | byte(right>>24)&0x0F,
+			byte(right >> 16), byte(right >> 8), byte(right),
+		}
+	default:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b[0:4], uint32(left))
+		binary.BigEndian.PutUint32(b[4:8], uint32(right))
+		return b
+	}
+}
+
+// Encode writes value in the data section format
+func Encode(buf *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case string:
+		writeControl(buf, typeString, uint(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		writeControl(buf, typeBytes, uint(len(v)))
+		buf.Write(v)
+	case bool:
+		size := uint(0)
+		if v {
+			size = 1
+		}
+		writeControl(buf, typeBool, size)
+	case float64:
+		writeControl(buf, typeDouble, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		writeUint(buf, typeUint16, uint64(v))
+	case uint32:
+		writeUint(buf, typeUint32, uint64(v))
+	case uint64:
+		writeUint(buf, typeUint64, v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeControl(buf, typeMap, uint(len(v)))
+		for _, key := range keys {
+			Encode(buf, key)
+			if err := Encode(buf, v[key]); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	case []any:
+		writeControl(buf, typeArray, uint(len(v)))
+		for _, item := range v {
+			if err := Encode(buf, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T", value)
+	}
+	return nil
+}
+
+// writeUint writes an unsigned integer without leading zero bytes
+func writeUint(buf *bytes.Buffer, typeNum int, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	trimmed := bytes.TrimLeft(b[:], "\x00")
+	writeControl(buf, typeNum, uint(len(trimmed)))
+	buf.Write(trimmed)
+}
+
+// writeControl writes the control byte, extended type and size bytes
+func writeControl(buf *bytes.Buffer, typeNum int, size uint) {
+	ctrlType := byte(typeNum << 5)
+	if typeNum > 7 {
+		ctrlType = 0
+	}
+
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		buf.WriteByte(ctrlType | byte(size))
+	case size < 285:
+		buf.WriteByte(ctrlType | 29)
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		buf.WriteByte(ctrlType | 30)
+		n := size - 285
+		sizeBytes = []byte{byte(n >> 8), byte(n)}
+	default:
+		buf.WriteByte(ctrlType | 31)
+		n := size - 65821
+		sizeBytes = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+
+	if typeNum > 7 {
+		buf.WriteByte(byte(typeNum - 7))
+	}
+	buf.Write(sizeBytes)
+}
@@ -0,0 +1,26 @@
+package mmdbtest
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRecordSizeUnsupported(t *testing.T) {
+	writer := NewWriter("Test")
+	writer.SetRecordSize(16)
+	if _, err := writer.Bytes(); err == nil {
+		t.Fatal("Bytes accepted 16-bit records")
+	}
+}
+
+func TestWriterRejectsOverlap(t *testing.T) {
+	writer := NewWriter("Test")
+	_, wide, _ := net.ParseCIDR("192.0.2.0/24")
+	_, narrow, _ := net.ParseCIDR("192.0.2.128/25")
+	if err := writer.Insert(wide, map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Insert(narrow, map[string]any{}); err == nil {
+		t.Fatal("Insert accepted an overlapping network")
+	}
+}
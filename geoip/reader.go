@@ -0,0 +1,201 @@
+// Package geoip looks up country, city and ASN data for IP addresses in
+// local MaxMind DB (.mmdb) files, without any network access.
+package geoip
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+)
+
+// metadataMarker precedes the metadata section at the end of the file
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the size of the zero padding between the search
+// tree and the data section
+const dataSectionSeparator = 16
+
+// Metadata describes a MaxMind DB file
+type Metadata struct {
+	DatabaseType string
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+	BuildEpoch   uint64
+	Languages    []string
+}
+
+// Reader looks up records in a MaxMind DB file held in memory
+type Reader struct {
+	Metadata Metadata
+
+	buf       []byte
+	data      decoder
+	treeSize  uint
+	ipv4Start uint
+}
+
+// Open reads the MaxMind DB file at path
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := FromBytes(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+// FromBytes parses a MaxMind DB file from buf
+func FromBytes(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start == -1 {
+		return nil, fmt.Errorf("not a MaxMind DB file: metadata marker not found")
+	}
+	start += len(metadataMarker)
+
+	meta := decoder{buf: buf[start:]}
+	raw, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata: not a map")
+	}
+
+	r := &Reader{buf: buf}
+	r.Metadata.DatabaseType = stringField(fields, "database_type")
+	r.Metadata.IPVersion = uint(uintField(fields, "ip_version"))
+	r.Metadata.NodeCount = uint(uintField(fields, "node_count"))
+	r.Metadata.RecordSize = uint(uintField(fields, "record_size"))
+	r.Metadata.BuildEpoch = uintField(fields, "build_epoch")
+	if languages, ok := fields["languages"].([]any); ok {
+		for _, language := range languages {
+			if s, ok := language.(string); ok {
+				r.Metadata.Languages = append(r.Metadata.Languages, s)
+			}
+		}
+	}
+
+	switch r.Metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.Metadata.RecordSize)
+	}
+
+	r.treeSize = r.Metadata.NodeCount * r.Metadata.RecordSize / 4
+	dataStart := r.treeSize + dataSectionSeparator
+	if dataStart > uint(len(buf)) {
+		return nil, fmt.Errorf("search tree is larger than the file")
+	}
+	r.data = decoder{buf: buf[dataStart:]}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if r.Metadata.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.Metadata.NodeCount; i++ {
+			node, err = r.readNode(node, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// Lookup returns the record for ip, or nil if the database has none
+func (r *Reader) Lookup(ip net.IP) (map[string]any, error) {
+	bits := ip.To4()
+	node := uint(0)
+	if bits != nil {
+		if r.Metadata.IPVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.Metadata.IPVersion == 4 {
+			return nil, fmt.Errorf("cannot look up IPv6 address %s in an IPv4 database", ip)
+		}
+		bits = ip.To16()
+		if bits == nil {
+			return nil, fmt.Errorf("invalid IP address")
+		}
+	}
+
+	nodeCount := r.Metadata.NodeCount
+	for i := 0; i < len(bits)*8 && node < nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		var err error
+		node, err = r.readNode(node, bit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case node == nodeCount:
+		return nil, nil
+	case node < nodeCount:
+		return nil, fmt.Errorf("search tree is deeper than the address")
+	case node < nodeCount+dataSectionSeparator:
+		return nil, fmt.Errorf("corrupt database: record %d points into the data section separator", node)
+	}
+
+	offset := node - nodeCount - dataSectionSeparator
+	value, _, err := r.data.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	record, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("record is %T, not a map", value)
+	}
+	return record, nil
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of node
+func (r *Reader) readNode(node uint, bit uint) (uint, error) {
+	size := r.Metadata.RecordSize
+	offset := node * size / 4
+	if offset+size/4 > r.treeSize {
+		return 0, fmt.Errorf("node %d is outside the search tree", node)
+	}
+	b := r.buf[offset : offset+size/4]
+
+	switch size {
+	case 24:
+		if bit == 0 {
+			return uintFromBytes(b[0:3]), nil
+		}
+		return uintFromBytes(b[3:6]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uintFromBytes(b[0:3]), nil
+		}
+		return uint(b[3]&0x0F)<<24 | uintFromBytes(b[4:7]), nil
+	default:
+		if bit == 0 {
+			return uintFromBytes(b[0:4]), nil
+		}
+		return uintFromBytes(b[4:8]), nil
+	}
+}
+
+// stringField returns a string field of a decoded map, or ""
+func stringField(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// uintField returns an unsigned integer field of a decoded map, or 0
+func uintField(m map[string]any, key string) uint64 {
+	n, _ := m[key].(uint64)
+	return n
+}
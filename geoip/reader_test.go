@@ -0,0 +1,330 @@
+package geoip
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regproxy/geoip/internal/mmdbtest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openFixtures(t *testing.T) *Enricher {
+	t.Helper()
+	enricher, err := OpenDir("testdata")
+	if err != nil {
+		t.Fatalf("OpenDir: %v", err)
+	}
+	return enricher
+}
+
+func TestEnricherLookupFixtures(t *testing.T) {
+	enricher := openFixtures(t)
+
+	tests := []struct {
+		name    string
+		address string
+		want    Info
+	}{
+		{"v4", "192.0.2.55", Info{Country: "US", City: "New York", ASN: 64496, Org: "Example Transit"}},
+		{"v4 mapped into v6", "::ffff:198.51.100.7", Info{Country: "DE", City: "Berlin", ASN: 64497, Org: "Example Hosting GmbH"}},
+		{"v6", "2001:db8::1", Info{Country: "GB"}},
+		// The country database only covers 203.0.113.0/25, the ASN
+		// database the whole /24
+		{"inside /25", "203.0.113.127", Info{Country: "JP", ASN: 64498, Org: "Example Residential KK"}},
+		{"outside /25", "203.0.113.128", Info{ASN: 64498, Org: "Example Residential KK"}},
+		{"miss", "10.1.2.3", Info{}},
+		{"v6 miss", "2001:db9::1", Info{}},
+		{"bad ip", "not-an-ip", Info{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := enricher.LookupString(tt.address); got != tt.want {
+				t.Errorf("LookupString(%s) = %+v, want %+v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReaderMetadata(t *testing.T) {
+	reader, err := Open("testdata/GeoLite2-Country.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := reader.Metadata
+	if meta.DatabaseType != "GeoLite2-Country" || meta.IPVersion != 6 || meta.RecordSize != 24 {
+		t.Errorf("metadata = %+v", meta)
+	}
+	if len(meta.Languages) != 1 || meta.Languages[0] != "en" {
+		t.Errorf("languages = %v", meta.Languages)
+	}
+}
+
+func TestReaderLookupMiss(t *testing.T) {
+	reader, err := Open("testdata/GeoLite2-City.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := reader.Lookup(net.ParseIP("10.0.0.1"))
+	if err != nil || record != nil {
+		t.Fatalf("Lookup = %v, %v, want no record", record, err)
+	}
+}
+
+func TestFromBytesRejectsGarbage(t *testing.T) {
+	if _, err := FromBytes([]byte("not a database")); err == nil {
+		t.Fatal("FromBytes accepted a file without metadata")
+	}
+}
+
+func TestRecordSizes(t *testing.T) {
+	networks := map[string]map[string]any{
+		"192.0.2.0/24":  {"n": uint32(1)},
+		"10.0.0.0/8":    {"n": uint32(2)},
+		"2001:db8::/32": {"n": uint32(3)},
+	}
+
+	for _, size := range []uint{24, 28, 32} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			writer := mmdbtest.NewWriter("Test")
+			writer.SetRecordSize(size)
+			for cidr, record := range networks {
+				_, network, _ := net.ParseCIDR(cidr)
+				if err := writer.Insert(network, record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := writer.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := FromBytes(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reader.Metadata.RecordSize != size {
+				t.Fatalf("record size %d, want %d", reader.Metadata.RecordSize, size)
+			}
+
+			for address, want := range map[string]uint64{"192.0.2.1": 1, "10.200.0.1": 2, "2001:db8::5": 3} {
+				record, err := reader.Lookup(net.ParseIP(address))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := uintField(record, "n"); got != want {
+					t.Errorf("%s: n = %d, want %d", address, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeEncoding(t *testing.T) {
+	// Values use every bit of the record, including the shared nibble of
+	// 28-bit records
+	tests := []struct {
+		size        uint
+		left, right uint
+	}{
+		{24, 0xABCDEF, 0x123456},
+		{28, 0xABCDEF1, 0x1234567},
+		{28, 0xFFFFFFF, 0},
+		{32, 0xFEDCBA98, 0x12345678},
+	}
+	for _, tt := range tests {
+		node := mmdbtest.EncodeNode(tt.size, tt.left, tt.right)
+		reader := &Reader{
+			Metadata: Metadata{RecordSize: tt.size},
+			buf:      node,
+			treeSize: uint(len(node)),
+		}
+
+		left, err := reader.readNode(0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		right, err := reader.readNode(0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if left != tt.left || right != tt.right {
+			t.Errorf("%d bits: got %#x/%#x, want %#x/%#x", tt.size, left, right, tt.left, tt.right)
+		}
+	}
+}
+
+func TestDecodePointers(t *testing.T) {
+	// Pointers of every size, each with the offset its size adds
+	tests := []struct {
+		name    string
+		target  uint
+		pointer []byte
+	}{
+		{"1 byte", 700, []byte{0x20 | 700>>8, 700 & 0xFF}},
+		{"2 bytes", 3000, []byte{0x28, (3000 - 2048) >> 8, (3000 - 2048) & 0xFF}},
+		{"3 bytes", 526400, []byte{0x30, 0, 0, 526400 - 526336}},
+		{"4 bytes", 100, []byte{0x38, 0, 0, 0, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.target+6)
+			copy(buf, tt.pointer)
+			copy(buf[tt.target:], []byte{typeString<<5 | 5, 'h', 'e', 'l', 'l', 'o'})
+
+			d := decoder{buf: buf}
+			value, next, err := d.decode(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != "hello" {
+				t.Errorf("value = %v, want hello", value)
+			}
+			// Decoding continues after the pointer, not after its target
+			if next != uint(len(tt.pointer)) {
+				t.Errorf("next = %d, want %d", next, len(tt.pointer))
+			}
+		})
+	}
+}
+
+func TestDecodePointerInMap(t *testing.T) {
+	// {"a": "xyz", "b": <pointer to "xyz">}
+	var buf bytes.Buffer
+	buf.WriteByte(typeMap<<5 | 2)
+	mmdbtest.Encode(&buf, "a")
+	offset := buf.Len()
+	mmdbtest.Encode(&buf, "xyz")
+	mmdbtest.Encode(&buf, "b")
+	buf.Write([]byte{0x20, byte(offset)})
+
+	d := decoder{buf: buf.Bytes()}
+	value, _, err := d.decode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := value.(map[string]any)
+	if record["a"] != "xyz" || record["b"] != "xyz" {
+		t.Fatalf("record = %v", record)
+	}
+}
+
+func TestDecodePointerLoop(t *testing.T) {
+	d := decoder{buf: []byte{0x20, 0}}
+	if _, _, err := d.decode(0); err == nil {
+		t.Fatal("decoded a pointer to itself")
+	}
+}
+
+func TestWriterBuildEpoch(t *testing.T) {
+	writer := mmdbtest.NewWriter("Test")
+	writer.SetBuildEpoch(time.Unix(1735689600, 0))
+	data, err := writer.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := FromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Metadata.BuildEpoch != 1735689600 {
+		t.Fatalf("build epoch %d", reader.Metadata.BuildEpoch)
+	}
+}
+
+// rawDatabase builds an IPv4 database with a single 24-bit node whose
+// records hold left and right, followed by data
+func rawDatabase(t *testing.T, left, right uint, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.Write(mmdbtest.EncodeNode(24, left, right))
+	buf.Write(make([]byte, dataSectionSeparator))
+	buf.Write(data)
+	buf.Write(metadataMarker)
+	err := mmdbtest.Encode(&buf, map[string]any{
+		"database_type": "Test",
+		"ip_version":    uint16(4),
+		"node_count":    uint32(1),
+		"record_size":   uint16(24),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLookupCorruptRecord(t *testing.T) {
+	var record bytes.Buffer
+	mmdbtest.Encode(&record, map[string]any{"n": uint32(1)})
+
+	tests := []struct {
+		name    string
+		value   uint
+		wantErr string
+	}{
+		// Node count 1 plus the 16 byte separator is the first data offset
+		{"data", 17, ""},
+		{"separator start", 2, "corrupt database"},
+		{"separator end", 16, "corrupt database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := FromBytes(rawDatabase(t, tt.value, tt.value, record.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := reader.Lookup(net.ParseIP("192.0.2.1"))
+			switch {
+			case tt.wantErr == "" && (err != nil || uintField(got, "n") != 1):
+				t.Errorf("Lookup = %v, %v", got, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Lookup error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeCapsContainerSize(t *testing.T) {
+	// The largest size a control byte can claim, with nothing behind it
+	huge := []byte{0xFF, 0xFF, 0xFF}
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"map", append([]byte{typeMap<<5 | 31}, huge...)},
+		{"array", append([]byte{typeExtended<<5 | 31, typeArray - 7}, huge...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := decoder{buf: tt.buf}
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			before := stats.TotalAlloc
+			if _, _, err := d.decode(0); err == nil {
+				t.Fatal("decoded a truncated container")
+			}
+			// Room for 16 million elements would take hundreds of MB
+			runtime.ReadMemStats(&stats)
+			if grown := stats.TotalAlloc - before; grown > 1<<20 {
+				t.Errorf("decoding allocated %d bytes", grown)
+			}
+		})
+	}
+
+	d := decoder{buf: make([]byte, 10)}
+	for _, tt := range []struct{ size, offset, min, want uint }{
+		{3, 0, 1, 3},
+		{100, 0, 1, 10},
+		{100, 4, 2, 3},
+		{100, 10, 1, 0},
+		{100, 20, 1, 0},
+	} {
+		if got := d.capacity(tt.size, tt.offset, tt.min); got != tt.want {
+			t.Errorf("capacity(%d, %d, %d) = %d, want %d", tt.size, tt.offset, tt.min, got, tt.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regproxy/secrets"
 	"strings"
 	"time"
 )
@@ -18,6 +19,7 @@ const (
 	INFO
 	WARN
 	ERROR
+	ALERT
 	FATAL
 )
 
@@ -32,6 +34,8 @@ func (l LogLevel) String() string {
 		return "WARN"
 	case ERROR:
 		return "ERROR"
+	case ALERT:
+		return "ALERT"
 	case FATAL:
 		return "FATAL"
 	default:
@@ -98,6 +102,8 @@ func parseLogLevel(level string) LogLevel {
 		return WARN
 	case "ERROR":
 		return ERROR
+	case "ALERT":
+		return ALERT
 	case "FATAL":
 		return FATAL
 	default:
@@ -113,7 +119,8 @@ func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
 	
 	timestamp := time.Now().Format("2006/01/02 15:04:05")
 	prefix := fmt.Sprintf("[%s] [%s] ", timestamp, level.String())
-	message := fmt.Sprintf(format, args...)
+	// Never let an API key reach the log
+	message := secrets.Redact(fmt.Sprintf(format, args...))
 	
 	l.logger.Printf("%s%s", prefix, message)
 }
@@ -138,6 +145,11 @@ func (l *Logger) Error(format string, args ...interface{}) {
 	l.log(ERROR, format, args...)
 }
 
+// Alert logs a problem that needs an operator, such as a revoked API key
+func (l *Logger) Alert(format string, args ...interface{}) {
+	l.log(ALERT, format, args...)
+}
+
 // Fatal logs a fatal message and exits
 func (l *Logger) Fatal(format string, args ...interface{}) {
 	l.log(FATAL, format, args...)
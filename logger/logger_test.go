@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"regproxy/secrets"
+	"strings"
+	"testing"
+)
+
+func TestLogRedactsSecrets(t *testing.T) {
+	secrets.Register("sk_logger_0123456789")
+
+	path := filepath.Join(t.TempDir(), "logs", "regproxy.log")
+	log, err := NewLogger("debug", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("testing %s with key %s", "https://api.example.com/?key=sk_logger_0123456789", "sk_logger_0123456789")
+	log.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := string(data)
+	if strings.Contains(line, "sk_logger_0123456789") {
+		t.Fatalf("secret logged: %s", line)
+	}
+	if !strings.Contains(line, "[INFO] testing https://api.example.com/?key=sk_l...6789 with key sk_l...6789") {
+		t.Errorf("unexpected log line: %s", line)
+	}
+}
@@ -30,7 +30,7 @@ func main() {
 	fmt.Println("🚀 RegProxy - Proxy Testing Daemon")
 	fmt.Println("===================================")
 	fmt.Printf("Configuration loaded from: %s\n", *configFile)
-	fmt.Printf("ElevenLabs API URL: %s\n", cfg.API.ElevenLabs.URL)
+	fmt.Printf("Check: %s\n", cfg.Daemon.Check)
 	fmt.Printf("Test interval: %v\n", cfg.GetInterval())
 	fmt.Printf("Threads: %d\n", cfg.Daemon.Threads)
 	fmt.Printf("Timeout: %v\n", cfg.GetTimeout())
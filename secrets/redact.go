@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minSecretLen keeps short values such as "test" from being masked
+// everywhere they happen to appear
+const minSecretLen = 6
+
+var (
+	redactMu sync.RWMutex
+	// Longest first, so a secret containing another is masked whole
+	registered []string
+)
+
+// Register marks value as a secret so Redact masks it
+func Register(value string) {
+	if len(value) < minSecretLen {
+		return
+	}
+
+	redactMu.Lock()
+	defer redactMu.Unlock()
+
+	for _, secret := range registered {
+		if secret == value {
+			return
+		}
+	}
+	registered = append(registered, value)
+	sort.Slice(registered, func(i, j int) bool {
+		return len(registered[i]) > len(registered[j])
+	})
+}
+
+// Mask returns a form of secret that is safe to display. Long keys keep
+// their first and last four characters so they can still be told apart.
+func Mask(secret string) string {
+	if len(secret) < 16 {
+		return "***"
+	}
+	return secret[:4] + "..." + secret[len(secret)-4:]
+}
+
+// Redact masks every registered secret in s
+func Redact(s string) string {
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+
+	for _, secret := range registered {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, Mask(secret))
+		}
+	}
+	return s
+}
+
+// redactedError carries a redacted message but still unwraps to the
+// original error, so errors.Is and errors.As keep working
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// RedactError returns err with registered secrets masked in its message
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := Redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
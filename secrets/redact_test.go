@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"short", "***"},
+		{"fifteen-chars-x", "***"},
+		{"sk_0123456789abcdef", "sk_0...cdef"},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.secret); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	Register("sk_redact_0123456789")
+	Register("redact_0123")
+	Register("tiny")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"url", "GET https://api.example.com/v1/models?key=sk_redact_0123456789&x=1",
+			"GET https://api.example.com/v1/models?key=sk_r...6789&x=1"},
+		{"header", "xi-api-key: sk_redact_0123456789", "xi-api-key: sk_r...6789"},
+		{"log line", "request failed for redact_0123 twice: redact_0123", "request failed for *** twice: ***"},
+		// The longer secret is masked whole, not through the shorter one
+		{"nested", "sk_redact_0123456789", "sk_r...6789"},
+		{"short values are not secrets", "tiny test", "tiny test"},
+		{"nothing registered", "nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	Register("sk_error_0123456789")
+
+	if RedactError(nil) != nil {
+		t.Error("RedactError(nil) is not nil")
+	}
+	clean := errors.New("no secret here")
+	if RedactError(clean) != clean {
+		t.Error("an error without secrets was wrapped")
+	}
+
+	err := RedactError(fmt.Errorf(`Get "https://api.example.com/?key=sk_error_0123456789": %w`, io.ErrUnexpectedEOF))
+	if want := `Get "https://api.example.com/?key=sk_e...6789": unexpected EOF`; err.Error() != want {
+		t.Errorf("message %q, want %q", err.Error(), want)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("redacted error no longer unwraps")
+	}
+}
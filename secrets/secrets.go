@@ -0,0 +1,82 @@
+// Package secrets resolves references to API keys and other secrets and
+// keeps resolved values out of logs and error messages.
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// refPattern matches ${env:NAME}, ${file:/path/to/secret} and ${secret:NAME}
+var refPattern = regexp.MustCompile(`\$\{(env|file|secret):([^}]+)\}`)
+
+var (
+	storeMu sync.RWMutex
+	store   *Store
+)
+
+// UseStore sets the encrypted store that ${secret:NAME} references read from
+func UseStore(s *Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store = s
+}
+
+// Resolve replaces secret references in value with the secret they point
+// to. ${env:NAME} reads an environment variable, ${file:/path} reads a file
+// such as a Docker or systemd credential and ${secret:NAME} reads the
+// encrypted store. Every resolved secret is registered for redaction.
+func Resolve(value string) (string, error) {
+	var resolveErr error
+
+	resolved := refPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		match := refPattern.FindStringSubmatch(ref)
+		secret, err := lookup(match[1], match[2])
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		Register(secret)
+		return secret
+	})
+
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return resolved, nil
+}
+
+// IsRef reports whether value contains a secret reference
+func IsRef(value string) bool {
+	return refPattern.MatchString(value)
+}
+
+// lookup resolves a single secret reference
+func lookup(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case "file":
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "secret":
+		storeMu.RLock()
+		s := store
+		storeMu.RUnlock()
+		if s == nil {
+			return "", fmt.Errorf("secret %s referenced but no secrets file is configured", name)
+		}
+		return s.Get(name)
+	default:
+		return "", fmt.Errorf("unknown secret reference %q", kind)
+	}
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("REGPROXY_TEST_TOKEN", "env-token-value")
+	file := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(file, []byte("file-token-value\n"), 0600)
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "secrets.json"), testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set("STORED", "stored-token-value")
+	UseStore(store)
+	t.Cleanup(func() { UseStore(nil) })
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"${env:REGPROXY_TEST_TOKEN}", "env-token-value"},
+		{"Bearer ${env:REGPROXY_TEST_TOKEN}", "Bearer env-token-value"},
+		{"${file:" + file + "}", "file-token-value"},
+		{"${secret:STORED}", "stored-token-value"},
+		// Only env, file and secret are references
+		{"${vault:NAME}", "${vault:NAME}"},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+
+	// Resolved secrets are masked from then on
+	if got := Redact("token env-token-value"); got != "token ***" {
+		t.Errorf("resolved secret redacted to %q", got)
+	}
+}
+
+func TestResolveUnknownReference(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "secrets.json"), testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseStore(store)
+	t.Cleanup(func() { UseStore(nil) })
+
+	for _, value := range []string{
+		"${env:REGPROXY_TEST_UNSET}",
+		"${file:" + filepath.Join(t.TempDir(), "missing") + "}",
+		"${secret:MISSING}",
+		"ok ${env:HOME} ${secret:MISSING}",
+	} {
+		if got, err := Resolve(value); err == nil {
+			t.Errorf("Resolve(%q) = %q, want an error", value, got)
+		}
+	}
+
+	UseStore(nil)
+	if _, err := Resolve("${secret:STORED}"); err == nil {
+		t.Error("resolved a secret without a store")
+	}
+}
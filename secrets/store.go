@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// KeyEnv is the environment variable holding the base64 store key when no
+// key file is given
+const KeyEnv = "REGPROXY_SECRETS_KEY"
+
+// storeVersion is the current version of the secrets file format
+const storeVersion = 1
+
+// Store is a local file of secrets, each encrypted with AES-256-GCM. The
+// file only holds ciphertext, the key lives in a separate file or in the
+// environment.
+type Store struct {
+	path    string
+	aead    cipher.AEAD
+	secrets map[string]string
+}
+
+// storeFile is the on-disk format of a Store
+type storeFile struct {
+	Version int               `json:"version"`
+	Secrets map[string]string `json:"secrets"`
+}
+
+// GenerateKey returns a new random store key, base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadKey reads the base64 store key from keyFile, or from the
+// REGPROXY_SECRETS_KEY environment variable when keyFile is empty
+func LoadKey(keyFile string) ([]byte, error) {
+	encoded := os.Getenv(KeyEnv)
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading secrets key: %v", err)
+		}
+		encoded = string(data)
+	}
+
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, fmt.Errorf("no secrets key: set %s or a key file", KeyEnv)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid secrets key: want 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// OpenStore opens the secrets file at path with key. A missing file is an
+// empty store, so secrets can be added to it with Set and Save.
+func OpenStore(path string, key []byte) (*Store, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path:    path,
+		aead:    aead,
+		secrets: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading secrets file: %v", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing secrets file: %v", err)
+	}
+	if file.Version != storeVersion {
+		return nil, fmt.Errorf("unsupported secrets file version %d", file.Version)
+	}
+	if file.Secrets != nil {
+		s.secrets = file.Secrets
+	}
+
+	return s, nil
+}
+
+// Get decrypts the named secret
+func (s *Store) Get(name string) (string, error) {
+	encoded, ok := s.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found in %s", name, s.path)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupt", name)
+	}
+
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	// The name is authenticated so ciphertexts cannot be swapped between
+	// entries
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s cannot be decrypted, wrong key?", name)
+	}
+	return string(plaintext), nil
+}
+
+// Set encrypts value and stores it under name. Call Save to write the file.
+func (s *Store) Set(name, value string) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	s.secrets[name] = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// Names returns the names of the stored secrets in sorted order
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.secrets))
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save writes the store back to its file, replacing it atomically
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(storeFile{Version: storeVersion, Secrets: s.secrets}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".secrets-*")
+	if err != nil {
+		return fmt.Errorf("error writing secrets file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing secrets file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing secrets file: %v", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
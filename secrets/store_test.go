@@ -0,0 +1,189 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testKey returns a new store key
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// savedStore creates a store file in a temporary directory holding values
+func savedStore(t *testing.T, key []byte, values map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	s, err := OpenStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range values {
+		if err := s.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	key := testKey(t)
+	values := map[string]string{
+		"ELEVENLABS_API_KEY": "sk_round_trip_0123456789",
+		"EMPTY":              "",
+	}
+	path := savedStore(t, key, values)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), values["ELEVENLABS_API_KEY"]) {
+		t.Fatal("secrets file holds the plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("secrets file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	s, err := OpenStore(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := s.Names(); !reflect.DeepEqual(names, []string{"ELEVENLABS_API_KEY", "EMPTY"}) {
+		t.Errorf("names %v", names)
+	}
+	for name, want := range values {
+		if got, err := s.Get(name); err != nil || got != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestStoreRejectsWrongKeyAndTampering(t *testing.T) {
+	key := testKey(t)
+	path := savedStore(t, key, map[string]string{"A": "first-secret", "B": "second-secret"})
+
+	t.Run("wrong key", func(t *testing.T) {
+		s, err := OpenStore(path, testKey(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get("A"); err == nil {
+			t.Error("decrypted with the wrong key")
+		}
+	})
+
+	// tamper rewrites the stored ciphertexts and opens the result
+	tamper := func(t *testing.T, change func(map[string]string)) *Store {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var file storeFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatal(err)
+		}
+		change(file.Secrets)
+		data, _ = json.Marshal(file)
+		tampered := filepath.Join(t.TempDir(), "secrets.json")
+		if err := os.WriteFile(tampered, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := OpenStore(tampered, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	t.Run("flipped bit", func(t *testing.T) {
+		s := tamper(t, func(secrets map[string]string) {
+			sealed, _ := base64.StdEncoding.DecodeString(secrets["A"])
+			sealed[len(sealed)-1] ^= 1
+			secrets["A"] = base64.StdEncoding.EncodeToString(sealed)
+		})
+		if _, err := s.Get("A"); err == nil {
+			t.Error("decrypted a tampered ciphertext")
+		}
+	})
+
+	t.Run("swapped entries", func(t *testing.T) {
+		s := tamper(t, func(secrets map[string]string) {
+			secrets["A"], secrets["B"] = secrets["B"], secrets["A"]
+		})
+		if _, err := s.Get("A"); err == nil {
+			t.Error("decrypted a ciphertext stored under another name")
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		s := tamper(t, func(secrets map[string]string) {
+			secrets["A"] = base64.StdEncoding.EncodeToString([]byte("short"))
+		})
+		if _, err := s.Get("A"); err == nil {
+			t.Error("decrypted a truncated ciphertext")
+		}
+	})
+}
+
+func TestOpenStore(t *testing.T) {
+	key := testKey(t)
+
+	// A missing file is an empty store
+	s, err := OpenStore(filepath.Join(t.TempDir(), "missing.json"), key)
+	if err != nil || len(s.Names()) != 0 {
+		t.Fatalf("OpenStore of a missing file = %v, %v", s, err)
+	}
+	if _, err := s.Get("A"); err == nil {
+		t.Error("Get of a missing secret succeeded")
+	}
+
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	os.WriteFile(path, []byte(`{"version": 2, "secrets": {}}`), 0600)
+	if _, err := OpenStore(path, key); err == nil {
+		t.Error("opened a store of version 2")
+	}
+	if _, err := OpenStore(path, key[:16]); err == nil {
+		t.Error("opened a store with a short key")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	encoded, _ := GenerateKey()
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte(encoded+"\n"), 0600)
+
+	if key, err := LoadKey(keyFile); err != nil || len(key) != 32 {
+		t.Errorf("LoadKey from a file = %d bytes, %v", len(key), err)
+	}
+
+	t.Setenv(KeyEnv, encoded)
+	if key, err := LoadKey(""); err != nil || len(key) != 32 {
+		t.Errorf("LoadKey from %s = %d bytes, %v", KeyEnv, len(key), err)
+	}
+
+	for _, bad := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		t.Setenv(KeyEnv, bad)
+		if _, err := LoadKey(""); err == nil {
+			t.Errorf("LoadKey accepted %q", bad)
+		}
+	}
+}
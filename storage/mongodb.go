@@ -13,20 +13,77 @@ import (
 
 // ProxyDocument represents a proxy document in MongoDB
 type ProxyDocument struct {
-	ID          string    `bson:"_id,omitempty"`
-	Address     string    `bson:"address"`
-	IP          string    `bson:"ip"`
-	Port        string    `bson:"port"`
-	Type        string    `bson:"type"`
-	Country     string    `bson:"country,omitempty"`
-	Anonymity   string    `bson:"anonymity,omitempty"`
-	IsWorking   bool      `bson:"is_working"`
-	LastTested  time.Time `bson:"last_tested"`
-	Latency     int64     `bson:"latency_ms"`
-	TestCount   int       `bson:"test_count"`
-	SuccessRate float64   `bson:"success_rate"`
-	CreatedAt   time.Time `bson:"created_at"`
-	UpdatedAt   time.Time `bson:"updated_at"`
+	ID             string         `bson:"_id,omitempty"`
+	Address        string         `bson:"address"`
+	IP             string         `bson:"ip"`
+	Port           string         `bson:"port"`
+	Type           string         `bson:"type"`
+	Country        string         `bson:"country,omitempty"`
+	Anonymity      string         `bson:"anonymity,omitempty"`
+	IsWorking      bool           `bson:"is_working"`
+	LastTested     time.Time      `bson:"last_tested"`
+	Latency        int64          `bson:"latency_ms"`
+	Throughput     float64        `bson:"throughput_bps,omitempty"`
+	TestCount      int            `bson:"test_count"`
+	SuccessRate    float64        `bson:"success_rate"`
+	LastErrorClass string         `bson:"last_error_class,omitempty"`
+	ErrorCounts    map[string]int `bson:"error_counts,omitempty"`
+	Profiles       []string       `bson:"profiles,omitempty"`
+	ExitIP         string         `bson:"exit_ip,omitempty"`
+	City           string         `bson:"city,omitempty"`
+	ASN            uint           `bson:"asn,omitempty"`
+	Org            string         `bson:"org,omitempty"`
+	ExitGeo        *GeoInfo       `bson:"exit_geo,omitempty"`
+	Stability      *Stability     `bson:"stability,omitempty"`
+	CreatedAt      time.Time      `bson:"created_at"`
+	UpdatedAt      time.Time      `bson:"updated_at"`
+	// Targets is the reachability matrix, keyed by check name
+	Targets map[string]TargetStatus `bson:"targets,omitempty"`
+	// Score is the composite score the daemon keeps proxies by
+	Score       float64 `bson:"score"`
+	LatencyEWMA int64   `bson:"latency_ewma_ms,omitempty"`
+	// Lifecycle state and when the proxy is due for a retest
+	State               string    `bson:"state,omitempty"`
+	StateSince          time.Time `bson:"state_since,omitempty"`
+	ConsecutiveFailures int       `bson:"consecutive_failures,omitempty"`
+	NextTest            time.Time `bson:"next_test,omitempty"`
+}
+
+// StateRecord is the stored lifecycle state of a proxy
+type StateRecord struct {
+	Address             string    `bson:"address"`
+	State               string    `bson:"state"`
+	StateSince          time.Time `bson:"state_since"`
+	ConsecutiveFailures int       `bson:"consecutive_failures"`
+	NextTest            time.Time `bson:"next_test"`
+	// Type is the proxy protocol, only filled in by LoadStates
+	Type string `bson:"type,omitempty"`
+}
+
+// TargetStatus is the last result of one check against a proxy
+type TargetStatus struct {
+	Reachable  bool      `bson:"reachable"`
+	StatusCode int       `bson:"status,omitempty"`
+	LatencyMs  int64     `bson:"latency_ms,omitempty"`
+	ErrorClass string    `bson:"error_class,omitempty"`
+	TestedAt   time.Time `bson:"tested_at"`
+}
+
+// GeoInfo is the GeoIP data of an address
+type GeoInfo struct {
+	Country string `bson:"country,omitempty"`
+	City    string `bson:"city,omitempty"`
+	ASN     uint   `bson:"asn,omitempty"`
+	Org     string `bson:"org,omitempty"`
+}
+
+// Stability holds the metrics of the last repeated-sample test of a proxy
+type Stability struct {
+	Samples      int       `bson:"samples"`
+	SuccessRatio float64   `bson:"success_ratio"`
+	P95Latency   int64     `bson:"p95_latency_ms"`
+	Jitter       int64     `bson:"jitter_ms"`
+	TestedAt     time.Time `bson:"tested_at"`
 }
 
 // MongoStorage handles MongoDB operations for proxy storage
@@ -101,6 +158,40 @@ func (m *MongoStorage) createIndexes(ctx context.Context) error {
 		},
 	}
 
+	// Index on profiles for per-profile queries
+	profilesIndex := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "profiles", Value: 1},
+			bson.E{Key: "is_working", Value: -1},
+		},
+	}
+
+	// Index on score, the order proxies are kept and loaded in
+	scoreIndex := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "is_working", Value: -1},
+			bson.E{Key: "score", Value: -1},
+		},
+	}
+
+	// Index on lifecycle state and retest time
+	stateIndex := mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "state", Value: 1},
+			bson.E{Key: "next_test", Value: 1},
+		},
+	}
+
+	// Index on exit IP to find proxies sharing an upstream
+	exitIPIndex := mongo.IndexModel{
+		Keys: bson.D{bson.E{Key: "exit_ip", Value: 1}},
+	}
+
+	// Wildcard index on the reachability matrix, target names are dynamic
+	targetsIndex := mongo.IndexModel{
+		Keys: bson.D{bson.E{Key: "targets.$**", Value: 1}},
+	}
+
 	// TTL index on updated_at (remove old non-working proxies after 7 days)
 	ttlIndex := mongo.IndexModel{
 		Keys:    bson.D{bson.E{Key: "updated_at", Value: 1}},
@@ -111,6 +202,11 @@ func (m *MongoStorage) createIndexes(ctx context.Context) error {
 		addressIndex,
 		workingIndex,
 		performanceIndex,
+		scoreIndex,
+		stateIndex,
+		profilesIndex,
+		exitIPIndex,
+		targetsIndex,
 		ttlIndex,
 	})
 
@@ -135,6 +231,7 @@ func (m *MongoStorage) SaveWorkingProxies(ctx context.Context, results []ProxyTe
 			IsWorking:  result.IsWorking,
 			LastTested: now,
 			Latency:    result.Latency.Milliseconds(),
+			Throughput: result.BytesPerSecond,
 			UpdatedAt:  now,
 		}
 
@@ -142,17 +239,56 @@ func (m *MongoStorage) SaveWorkingProxies(ctx context.Context, results []ProxyTe
 		if result.IsWorking {
 			filter := bson.M{"address": result.Address}
 
+			set := bson.M{
+				"ip":          doc.IP,
+				"port":        doc.Port,
+				"type":        doc.Type,
+				"is_working":  doc.IsWorking,
+				"last_tested": doc.LastTested,
+				"latency_ms":  doc.Latency,
+				"updated_at":  doc.UpdatedAt,
+				"profiles":    result.Profiles,
+				"score":       result.Score,
+			}
+
+			// Only overwrite throughput when it was measured this time
+			if doc.Throughput > 0 {
+				set["throughput_bps"] = doc.Throughput
+			}
+
+			if result.ExitIP != "" {
+				set["exit_ip"] = result.ExitIP
+			}
+			if result.LatencyEWMA > 0 {
+				set["latency_ewma_ms"] = result.LatencyEWMA.Milliseconds()
+			}
+
+			if geo := result.Geo; geo != nil {
+				set["country"] = geo.Country
+				set["city"] = geo.City
+				set["asn"] = geo.ASN
+				set["org"] = geo.Org
+			}
+			if result.ExitGeo != nil {
+				set["exit_geo"] = result.ExitGeo
+			}
+			setTargets(set, result.Targets, now)
+			setState(set, result.State)
+
+			// Likewise for stability, maintenance tests take one sample
+			if result.Samples > 0 {
+				set["stability"] = Stability{
+					Samples:      result.Samples,
+					SuccessRatio: result.SampleSuccessRatio,
+					P95Latency:   result.P95Latency.Milliseconds(),
+					Jitter:       result.Jitter.Milliseconds(),
+					TestedAt:     now,
+				}
+			}
+
 			// Calculate new success rate
 			updateWithSuccessRate := bson.M{
-				"$set": bson.M{
-					"ip":          doc.IP,
-					"port":        doc.Port,
-					"type":        doc.Type,
-					"is_working":  doc.IsWorking,
-					"last_tested": doc.LastTested,
-					"latency_ms":  doc.Latency,
-					"updated_at":  doc.UpdatedAt,
-				},
+				"$set": set,
 				"$inc": bson.M{
 					"test_count": 1,
 				},
@@ -168,16 +304,29 @@ func (m *MongoStorage) SaveWorkingProxies(ctx context.Context, results []ProxyTe
 
 			operations = append(operations, operation)
 		} else {
-			// For non-working proxies, just update the status
+			// For non-working proxies, just update the status and error history
+			errorClass := result.ErrorClass
+			if errorClass == "" {
+				errorClass = "unknown"
+			}
+
+			set := bson.M{
+				"is_working":       false,
+				"last_tested":      now,
+				"updated_at":       now,
+				"last_error_class": errorClass,
+				"profiles":         []string{},
+				"score":            result.Score,
+			}
+			setTargets(set, result.Targets, now)
+			setState(set, result.State)
+
 			filter := bson.M{"address": result.Address}
 			update := bson.M{
-				"$set": bson.M{
-					"is_working":  false,
-					"last_tested": now,
-					"updated_at":  now,
-				},
+				"$set": set,
 				"$inc": bson.M{
-					"test_count": 1,
+					"test_count":                 1,
+					"error_counts." + errorClass: 1,
 				},
 				"$setOnInsert": bson.M{
 					"ip":           doc.IP,
@@ -257,8 +406,91 @@ func (m *MongoStorage) GetWorkingProxies(ctx context.Context, limit int) ([]stri
 		},
 	}
 
+	return m.findWorkingProxies(ctx, filter, limit)
+}
+
+// setTargets adds the tested targets to a $set document one by one, so
+// the results of targets not tested this time are kept
+func setTargets(set bson.M, targets map[string]TargetStatus, now time.Time) {
+	for name, status := range targets {
+		if status.TestedAt.IsZero() {
+			status.TestedAt = now
+		}
+		set["targets."+name] = status
+	}
+}
+
+// setState adds the lifecycle state to a $set document
+func setState(set bson.M, state *StateRecord) {
+	if state == nil {
+		return
+	}
+	set["state"] = state.State
+	set["state_since"] = state.StateSince
+	set["consecutive_failures"] = state.ConsecutiveFailures
+	set["next_test"] = state.NextTest
+}
+
+// LoadStates returns the lifecycle state of every proxy that has one
+func (m *MongoStorage) LoadStates(ctx context.Context) ([]StateRecord, error) {
+	filter := bson.M{"state": bson.M{"$exists": true}}
+	opts := options.Find().SetProjection(bson.M{
+		"address":              1,
+		"state":                1,
+		"state_since":          1,
+		"consecutive_failures": 1,
+		"next_test":            1,
+		"type":                 1,
+	})
+
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query proxy states: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []StateRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode proxy states: %v", err)
+	}
+	return records, nil
+}
+
+// GetProxiesReaching retrieves working proxies whose last check of every
+// target passed
+func (m *MongoStorage) GetProxiesReaching(ctx context.Context, targets []string, limit int) ([]string, error) {
+	filter := bson.M{
+		"is_working": true,
+		"last_tested": bson.M{
+			"$gte": time.Now().Add(-24 * time.Hour), // Only proxies tested in last 24 hours
+		},
+	}
+	for _, target := range targets {
+		filter["targets."+target+".reachable"] = true
+	}
+
+	return m.findWorkingProxies(ctx, filter, limit)
+}
+
+// GetWorkingProxiesForProfile retrieves working proxies that passed the
+// given check profile
+func (m *MongoStorage) GetWorkingProxiesForProfile(ctx context.Context, profile string, limit int) ([]string, error) {
+	filter := bson.M{
+		"is_working": true,
+		"profiles":   profile,
+		"last_tested": bson.M{
+			"$gte": time.Now().Add(-24 * time.Hour), // Only proxies tested in last 24 hours
+		},
+	}
+
+	return m.findWorkingProxies(ctx, filter, limit)
+}
+
+// findWorkingProxies returns the addresses of the best proxies matching filter
+func (m *MongoStorage) findWorkingProxies(ctx context.Context, filter bson.M, limit int) ([]string, error) {
 	opts := options.Find().
 		SetSort(bson.D{
+			{Key: "score", Value: -1},
 			{Key: "success_rate", Value: -1},
 			{Key: "latency_ms", Value: 1},
 		}).
@@ -283,8 +515,17 @@ func (m *MongoStorage) GetWorkingProxies(ctx context.Context, limit int) ([]stri
 	return proxies, cursor.Err()
 }
 
+// ProxyStats summarises the stored proxies
+type ProxyStats struct {
+	Total          int       `bson:"total" json:"total"`
+	Working        int       `bson:"working" json:"working"`
+	AvgLatencyMs   float64   `bson:"avg_latency" json:"avg_latency_ms"`
+	AvgSuccessRate float64   `bson:"avg_success_rate" json:"avg_success_rate"`
+	Timestamp      time.Time `bson:"-" json:"timestamp"`
+}
+
 // GetProxyStats returns statistics about stored proxies
-func (m *MongoStorage) GetProxyStats(ctx context.Context) (map[string]interface{}, error) {
+func (m *MongoStorage) GetProxyStats(ctx context.Context) (*ProxyStats, error) {
 	pipeline := []bson.M{
 		{
 			"$group": bson.M{
@@ -311,7 +552,7 @@ func (m *MongoStorage) GetProxyStats(ctx context.Context) (map[string]interface{
 	}
 	defer cursor.Close(ctx)
 
-	var result map[string]interface{}
+	var result ProxyStats
 	if cursor.Next(ctx) {
 		if err := cursor.Decode(&result); err != nil {
 			return nil, fmt.Errorf("failed to decode stats: %v", err)
@@ -319,8 +560,8 @@ func (m *MongoStorage) GetProxyStats(ctx context.Context) (map[string]interface{
 	}
 
 	// Add timestamp
-	result["timestamp"] = time.Now()
-	return result, nil
+	result.Timestamp = time.Now()
+	return &result, nil
 }
 
 // CleanupOldProxies removes old non-working proxies
@@ -357,5 +598,29 @@ type ProxyTestResult struct {
 	Type      string
 	IsWorking bool
 	Latency   time.Duration
-	Error     error
+	// BytesPerSecond is the measured throughput, zero when not measured
+	BytesPerSecond float64
+	Error          error
+	// ErrorClass is the category of Error, empty for working proxies
+	ErrorClass string
+	// Profiles lists the check profiles the proxy passed
+	Profiles []string
+	// ExitIP is the address the proxy egressed from, empty when unknown
+	ExitIP string
+	// Geo and ExitGeo are the GeoIP data of IP and ExitIP, nil when unknown
+	Geo     *GeoInfo
+	ExitGeo *GeoInfo
+	// Targets holds the checks run this time, TestedAt may be left zero
+	Targets map[string]TargetStatus
+	// Score and LatencyEWMA come from the daemon's scoring model
+	Score       float64
+	LatencyEWMA time.Duration
+	// State is the lifecycle state after this test, left empty when the
+	// daemon does not track it
+	State *StateRecord
+	// Stability metrics, Samples is zero when the proxy was tested once
+	Samples            int
+	SampleSuccessRatio float64
+	P95Latency         time.Duration
+	Jitter             time.Duration
 }